@@ -5,52 +5,145 @@
 package goryman
 
 import (
+	"crypto/tls"
+	"errors"
 	"net"
+	"sync"
 	"time"
 
 	pb "code.google.com/p/goprotobuf/proto"
 	"github.com/bigdatadev/goryman/proto"
 )
 
+// MAX_MESSAGE_SIZE is the default maximum size of a message packed by SendEvents
+const MAX_MESSAGE_SIZE = 1 << 20
+
+// ErrNotConnected is returned when sending while the client has no connection to Riemann
+var ErrNotConnected = errors.New("not connected to riemann")
+
 // GorymanClient is a client library to send events to Riemann
 type GorymanClient struct {
-	udp  *UdpTransport
-	tcp  *TcpTransport
-	addr string
+	mu             sync.RWMutex
+	udp            *UdpTransport
+	tcp            *TcpTransport
+	addr           string
+	maxMessageSize int
+	tlsConfig      *tls.Config
+	acknowledged   bool
+	reconnect      *reconnectPolicy
+	redialing      bool
+	closed         bool
+	onStateChange  func(state ConnState, err error)
 }
 
 // NewGorymanClient - Factory
 func NewGorymanClient(addr string) *GorymanClient {
 	return &GorymanClient{
-		addr: addr,
+		addr:           addr,
+		maxMessageSize: MAX_MESSAGE_SIZE,
 	}
 }
 
-// Connect creates a UDP and TCP connection to a Riemann server
+// SetMaxMessageSize sets the maximum size of a message packed by SendEvents
+func (c *GorymanClient) SetMaxMessageSize(size int) {
+	c.maxMessageSize = size
+}
+
+// SetAcknowledged makes every message go over TCP and wait for the acknowledgement of Riemann,
+// so that a send only succeeds once Riemann got it. UDP, whose writes succeed even when
+// nothing listens, is not used. It must be called before Connect.
+func (c *GorymanClient) SetAcknowledged(acknowledged bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.acknowledged = acknowledged
+}
+
+// Connect creates a UDP and TCP connection to a Riemann server.
+// When reconnection is enabled and the server can't be reached, the client keeps dialing in the background.
 func (c *GorymanClient) Connect() error {
+	err := c.dial()
+	if err != nil {
+		c.disconnected(err)
+		return err
+	}
+	c.notify(Connected, nil)
+	return nil
+}
+
+// dial opens the connections and installs their transports, only the TCP one over TLS or when acknowledged
+func (c *GorymanClient) dial() error {
+	c.mu.RLock()
+	tlsConfig, acknowledged := c.tlsConfig, c.acknowledged
+	c.mu.RUnlock()
+
+	if tlsConfig != nil {
+		dialer := &net.Dialer{Timeout: time.Second * 5}
+		tcp, err := tls.DialWithDialer(dialer, "tcp", c.addr, tlsConfig)
+		if err != nil {
+			return err
+		}
+		return c.install(nil, tcp)
+	}
+	if acknowledged {
+		tcp, err := net.DialTimeout("tcp", c.addr, time.Second*5)
+		if err != nil {
+			return err
+		}
+		return c.install(nil, tcp)
+	}
+
 	udp, err := net.DialTimeout("udp", c.addr, time.Second*5)
 	if err != nil {
 		return err
 	}
 	tcp, err := net.DialTimeout("tcp", c.addr, time.Second*5)
 	if err != nil {
+		udp.Close()
 		return err
 	}
-	c.udp = NewUdpTransport(udp)
+	return c.install(udp, tcp)
+}
+
+// install sets up the transports of freshly dialed connections, udp may be nil
+func (c *GorymanClient) install(udp net.Conn, tcp net.Conn) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		if nil != udp {
+			udp.Close()
+		}
+		tcp.Close()
+		return ErrNotConnected
+	}
+	if nil != udp {
+		c.udp = NewUdpTransport(udp)
+	}
 	c.tcp = NewTcpTransport(tcp)
 	return nil
 }
 
 // Close the connection to Riemann
 func (c *GorymanClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return c.closeTransports()
+}
+
+// closeTransports closes the transports, the caller must hold the write lock
+func (c *GorymanClient) closeTransports() error {
 	if nil == c.udp && nil == c.tcp {
 		return nil
 	}
-	err := c.udp.Close()
-	if err != nil {
-		return err
+	udp, tcp := c.udp, c.tcp
+	c.udp, c.tcp = nil, nil
+	if nil != udp {
+		if err := udp.Close(); err != nil {
+			tcp.Close()
+			return err
+		}
 	}
-	return c.tcp.Close()
+	return tcp.Close()
 }
 
 // Send an event
@@ -67,6 +160,57 @@ func (c *GorymanClient) SendEvent(e *Event) error {
 	return err
 }
 
+// Send a batch of events, packing as many of them as fit in the maximum message size into each message
+func (c *GorymanClient) SendEvents(events []*Event) error {
+	_, err := c.DeliverEvents(events)
+	return err
+}
+
+// DeliverEvents sends a batch of events like SendEvents, and returns how many of them, from the
+// first one, were sent before an error. When acknowledged, those are known to have reached Riemann.
+func (c *GorymanClient) DeliverEvents(events []*Event) (int, error) {
+	messages, err := c.packEvents(events)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, message := range messages {
+		if _, err = c.sendMaybeRecv(message); err != nil {
+			return sent, err
+		}
+		sent += len(message.Events)
+	}
+	return sent, nil
+}
+
+// packEvents packs events into as few messages as the maximum message size allows, in order
+func (c *GorymanClient) packEvents(events []*Event) ([]*proto.Msg, error) {
+	var messages []*proto.Msg
+	message := &proto.Msg{}
+	size := 0
+	for _, e := range events {
+		epb, err := EventToProtocolBuffer(e)
+		if err != nil {
+			return nil, err
+		}
+
+		// Each event is embedded with a one byte field key and its varint length
+		n := pb.Size(epb)
+		n += 1 + len(pb.EncodeVarint(uint64(n)))
+		if len(message.Events) > 0 && size+n > c.maxMessageSize {
+			messages = append(messages, message)
+			message = &proto.Msg{}
+			size = 0
+		}
+		message.Events = append(message.Events, epb)
+		size += n
+	}
+	if len(message.Events) > 0 {
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
 // Send a state update
 func (c *GorymanClient) SendState(s *State) error {
 	spb, err := StateToProtocolBuffer(s)
@@ -99,14 +243,37 @@ func (c *GorymanClient) QueryEvents(q string) ([]Event, error) {
 
 // Send and receive data from Riemann
 func (c *GorymanClient) sendRecv(m *proto.Msg) (*proto.Msg, error) {
-	return c.tcp.SendRecv(m)
+	c.mu.RLock()
+	if nil == c.tcp {
+		c.mu.RUnlock()
+		return nil, ErrNotConnected
+	}
+	msg, err := c.tcp.SendRecv(m)
+	c.mu.RUnlock()
+	if err != nil {
+		c.checkConnection(err)
+	}
+	return msg, err
 }
 
 // Send and maybe receive data from Riemann
 func (c *GorymanClient) sendMaybeRecv(m *proto.Msg) (*proto.Msg, error) {
-	_, err := c.udp.SendMaybeRecv(m)
+	c.mu.RLock()
+	if nil == c.tcp {
+		c.mu.RUnlock()
+		return nil, ErrNotConnected
+	}
+	// Without UDP, as over TLS, everything goes over TCP
+	if nil != c.udp {
+		if _, err := c.udp.SendMaybeRecv(m); err == nil {
+			c.mu.RUnlock()
+			return nil, nil
+		}
+	}
+	msg, err := c.tcp.SendMaybeRecv(m)
+	c.mu.RUnlock()
 	if err != nil {
-		return c.tcp.SendMaybeRecv(m)
+		c.checkConnection(err)
 	}
-	return nil, nil
+	return msg, err
 }
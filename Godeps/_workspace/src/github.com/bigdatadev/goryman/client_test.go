@@ -0,0 +1,113 @@
+package goryman
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	pb "code.google.com/p/goprotobuf/proto"
+	"github.com/bigdatadev/goryman/proto"
+)
+
+func testEvents(n int) []*Event {
+	events := make([]*Event, n)
+	for i := range events {
+		events[i] = &Event{Host: "h", Service: "moargore", Metric: i}
+	}
+	return events
+}
+
+func TestPackEvents(t *testing.T) {
+	c := NewGorymanClient("localhost:5555")
+	messages, err := c.packEvents(testEvents(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || len(messages[0].Events) != 100 {
+		t.Fatalf("packed 100 small events into %d messages, want 1", len(messages))
+	}
+
+	c.SetMaxMessageSize(200)
+	messages, err = c.packEvents(testEvents(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for _, message := range messages {
+		if size := pb.Size(message); size > 200 {
+			t.Errorf("message of %d bytes, beyond the maximum of 200", size)
+		}
+		count += len(message.Events)
+	}
+	if len(messages) < 2 || count != 100 {
+		t.Errorf("packed 100 events into %d messages holding %d events", len(messages), count)
+	}
+	if metric := messages[1].Events[0].GetMetricSint64(); metric != int64(len(messages[0].Events)) {
+		t.Errorf("second message starts with event %d, want %d", metric, len(messages[0].Events))
+	}
+
+	// An event larger than the maximum still goes, on its own
+	c.SetMaxMessageSize(1)
+	if messages, err = c.packEvents(testEvents(3)); err != nil || len(messages) != 3 {
+		t.Errorf("packed 3 events larger than the maximum into %d messages (%v), want 3", len(messages), err)
+	}
+}
+
+// ackServer acknowledges the first acks messages it gets, then closes the connection
+func ackServer(t *testing.T, acks int) (addr string, received chan int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received = make(chan int, 100)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for i := 0; i < acks; i++ {
+			var size uint32
+			if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+				return
+			}
+			data := make([]byte, size)
+			if _, err := io.ReadFull(conn, data); err != nil {
+				return
+			}
+			message := &proto.Msg{}
+			if err := pb.Unmarshal(data, message); err != nil {
+				return
+			}
+			received <- len(message.Events)
+
+			ack, _ := pb.Marshal(&proto.Msg{Ok: pb.Bool(true)})
+			binary.Write(conn, binary.BigEndian, uint32(len(ack)))
+			conn.Write(ack)
+		}
+	}()
+	return l.Addr().String(), received
+}
+
+func TestDeliverEvents(t *testing.T) {
+	addr, received := ackServer(t, 2)
+	c := NewGorymanClient(addr)
+	c.SetAcknowledged(true)
+	c.SetMaxMessageSize(200)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	events := testEvents(100)
+	delivered, err := c.DeliverEvents(events)
+	if err == nil {
+		t.Fatalf("delivered all %d events to a server acknowledging 2 messages", delivered)
+	}
+	acknowledged := <-received + <-received
+	if delivered != acknowledged {
+		t.Errorf("DeliverEvents returned %d delivered events, the server acknowledged %d", delivered, acknowledged)
+	}
+}
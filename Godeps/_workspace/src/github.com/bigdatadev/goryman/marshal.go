@@ -108,31 +108,8 @@ func StateToProtocolBuffer(state *State) (*proto.State, error) {
 			case "Tags":
 				tmp := reflect.ValueOf(value.Interface().([]string))
 				t.FieldByName(name).Set(tmp)
-			case "Metric":
-				switch reflect.TypeOf(f.Interface()).Kind() {
-				case reflect.Int:
-					tmp := reflect.ValueOf(pb.Int64(int64(value.Int())))
-					t.FieldByName("MetricSint64").Set(tmp)
-				case reflect.Float32:
-					tmp := reflect.ValueOf(pb.Float32(float32(value.Float())))
-					t.FieldByName("MetricF").Set(tmp)
-				case reflect.Float64:
-					tmp := reflect.ValueOf(pb.Float64(value.Float()))
-					t.FieldByName("MetricD").Set(tmp)
-				default:
-					return nil, fmt.Errorf("Metric of invalid type (type %v)",
-						reflect.TypeOf(f.Interface()).Kind())
-				}
-			case "Attributes":
-				var attrs []*proto.Attribute
-				for k, v := range value.Interface().(map[string]string) {
-					k_, v_ := k, v
-					attrs = append(attrs, &proto.Attribute{
-						Key:   &k_,
-						Value: &v_,
-					})
-				}
-				t.FieldByName(name).Set(reflect.ValueOf(attrs))
+			case "Metric", "Attributes":
+				// Riemann states carry neither a metric nor attributes, these are left out
 			}
 		}
 	}
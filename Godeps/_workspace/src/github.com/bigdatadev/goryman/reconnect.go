@@ -0,0 +1,139 @@
+package goryman
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// ConnState is the state of the connection between the client and Riemann
+type ConnState int
+
+const (
+	Disconnected ConnState = iota
+	Connected
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case Connected:
+		return "connected"
+	}
+	return "disconnected"
+}
+
+// reconnectPolicy bounds the exponential backoff between two dials
+type reconnectPolicy struct {
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// SetReconnect enables automatic reconnection. Broken connections are redialed
+// with an exponential backoff starting at min and capped at max, with jitter.
+// min must be positive, and no greater than max.
+func (c *GorymanClient) SetReconnect(min, max time.Duration) error {
+	if min <= 0 {
+		return fmt.Errorf("invalid minimum backoff %s, it must be positive", min)
+	}
+	if max < min {
+		return fmt.Errorf("invalid maximum backoff %s, it must be at least the minimum backoff %s", max, min)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reconnect = &reconnectPolicy{
+		minBackoff: min,
+		maxBackoff: max,
+	}
+	return nil
+}
+
+// OnStateChange registers a function called whenever the client gets connected or
+// disconnected, along with the error that caused the disconnection
+func (c *GorymanClient) OnStateChange(f func(state ConnState, err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onStateChange = f
+}
+
+// notify reports a connection state change to the registered function, if any
+func (c *GorymanClient) notify(state ConnState, err error) {
+	c.mu.RLock()
+	f := c.onStateChange
+	c.mu.RUnlock()
+	if f != nil {
+		f(state, err)
+	}
+}
+
+// checkConnection tears the connection down when err shows it is broken
+func (c *GorymanClient) checkConnection(err error) {
+	if _, ok := err.(*ServerError); ok {
+		// Riemann answered, the connection is fine
+		return
+	}
+
+	c.mu.Lock()
+	if nil == c.tcp {
+		// Someone else already noticed
+		c.mu.Unlock()
+		return
+	}
+	c.closeTransports()
+	c.mu.Unlock()
+
+	c.disconnected(err)
+}
+
+// disconnected reports the disconnection and starts redialing when enabled
+func (c *GorymanClient) disconnected(err error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	policy := c.reconnect
+	start := policy != nil && !c.redialing
+	if start {
+		c.redialing = true
+	}
+	c.mu.Unlock()
+
+	c.notify(Disconnected, err)
+	if start {
+		go c.redial(policy)
+	}
+}
+
+// redial keeps dialing Riemann until it succeeds or the client gets closed
+func (c *GorymanClient) redial(policy *reconnectPolicy) {
+	backoff := policy.minBackoff
+	for {
+		// Sleep between half and all of the backoff, so that many clients don't redial in lockstep
+		half := int64(backoff / 2)
+		time.Sleep(time.Duration(half + rand.Int63n(half+1)))
+
+		c.mu.RLock()
+		closed := c.closed
+		c.mu.RUnlock()
+		if closed {
+			break
+		}
+
+		if err := c.dial(); err == nil {
+			break
+		}
+
+		backoff *= 2
+		if backoff > policy.maxBackoff {
+			backoff = policy.maxBackoff
+		}
+	}
+
+	c.mu.Lock()
+	c.redialing = false
+	connected := nil != c.tcp
+	c.mu.Unlock()
+	if connected {
+		c.notify(Connected, nil)
+	}
+}
@@ -0,0 +1,29 @@
+package goryman
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetReconnect(t *testing.T) {
+	tests := []struct {
+		min, max time.Duration
+		valid    bool
+	}{
+		{time.Second, time.Minute, true},
+		{time.Second, time.Second, true},
+		{0, time.Minute, false},
+		{-time.Second, time.Minute, false},
+		{time.Minute, time.Second, false},
+	}
+	for _, test := range tests {
+		c := NewGorymanClient("localhost:5555")
+		err := c.SetReconnect(test.min, test.max)
+		if (err == nil) != test.valid {
+			t.Errorf("SetReconnect(%s, %s) = %v, want valid %v", test.min, test.max, err, test.valid)
+		}
+		if (c.reconnect != nil) != test.valid {
+			t.Errorf("SetReconnect(%s, %s) enabled reconnection: %v", test.min, test.max, c.reconnect != nil)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package goryman
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSOptions sets how the client talks TLS to Riemann
+type TLSOptions struct {
+	// PEM bundle of the authorities trusted to sign the server certificate, the system ones when empty
+	CAFile string
+	// PEM client certificate and key, for mutual TLS
+	CertFile string
+	KeyFile  string
+	// Name expected in the server certificate, the host of the server address when empty
+	ServerName string
+	// Don't verify the server certificate at all, for lab use only
+	InsecureSkipVerify bool
+}
+
+// SetTLS makes the client connect to Riemann over TLS. TLS only applies to TCP,
+// so UDP is disabled and every message goes over TCP.
+func (c *GorymanClient) SetTLS(opts *TLSOptions) error {
+	config := &tls.Config{
+		ServerName:         opts.ServerName,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+
+	if opts.CAFile != "" {
+		pem, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in %s", opts.CAFile)
+		}
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tlsConfig = config
+	return nil
+}
@@ -3,10 +3,10 @@ package goryman
 import (
 	"bytes"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
 	"net"
+	"time"
 
 	pb "code.google.com/p/goprotobuf/proto"
 	"github.com/bigdatadev/goryman/proto"
@@ -42,9 +42,21 @@ type response struct {
 	err     error
 }
 
+// ServerError is returned when Riemann received a message but refused it
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return e.Message
+}
+
 // MAX_UDP_SIZE is the maximum allowed size of a UDP packet before automatically failing the send
 const MAX_UDP_SIZE = 16384
 
+// TCP_TIMEOUT is the time allowed for a TCP message to be sent and acknowledged
+const TCP_TIMEOUT = time.Second * 10
+
 // NewTcpTransport - Factory
 func NewTcpTransport(conn net.Conn) *TcpTransport {
 	t := &TcpTransport{
@@ -107,6 +119,10 @@ func (t *TcpTransport) execRequest(message *proto.Msg) (*proto.Msg, error) {
 	if err != nil {
 		return msg, err
 	}
+	// A server that went away silently must not hang the request queue
+	if err = t.conn.SetDeadline(time.Now().Add(TCP_TIMEOUT)); err != nil {
+		return msg, err
+	}
 	b := new(bytes.Buffer)
 	if err = binary.Write(b, binary.BigEndian, uint32(len(data))); err != nil {
 		return msg, err
@@ -129,7 +145,7 @@ func (t *TcpTransport) execRequest(message *proto.Msg) (*proto.Msg, error) {
 		return msg, err
 	}
 	if msg.GetOk() != true {
-		return msg, errors.New(msg.GetError())
+		return msg, &ServerError{msg.GetError()}
 	}
 	return msg, nil
 }
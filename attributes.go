@@ -0,0 +1,111 @@
+package main
+
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// metricUnits are the units of the metrics, by name. Rates are in the unit of their counter per second.
+var metricUnits = map[string]string{
+	"Machine.Cores":    "cores",
+	"Machine.MemoryMB": "megabytes",
+	"Cpu.Load":         "tasks",
+	"Cpu.Usage.Total":  "nanoseconds",
+	"Cpu.Usage.User":   "nanoseconds",
+	"Cpu.Usage.System": "nanoseconds",
+	"Cpu.Imbalance":    "percent",
+
+	"Machine.Cpu.Imbalance": "percent",
+
+	"Network.RxBytes":   "bytes",
+	"Network.RxPackets": "packets",
+	"Network.RxErrors":  "packets",
+	"Network.RxDropped": "packets",
+	"Network.TxBytes":   "bytes",
+	"Network.TxPackets": "packets",
+	"Network.TxErrors":  "packets",
+	"Network.TxDropped": "packets",
+
+	"Memory.Pgminfault":              "faults",
+	"Memory.Pgmajfault":              "faults",
+	"Memory.Hierarchical.Pgminfault": "faults",
+	"Memory.Hierarchical.Pgmajfault": "faults",
+
+	"Filesystem.ReadsCompleted":  "ios",
+	"Filesystem.ReadsMerged":     "ios",
+	"Filesystem.SectorsRead":     "sectors",
+	"Filesystem.ReadTime":        "milliseconds",
+	"Filesystem.WritesCompleted": "ios",
+	"Filesystem.WritesMerged":    "ios",
+	"Filesystem.SectorsWritten":  "sectors",
+	"Filesystem.WriteTime":       "milliseconds",
+	"Filesystem.IoTime":          "milliseconds",
+	"Filesystem.WeightedIoTime":  "milliseconds",
+	"Filesystem.AvgQueueSize":    "ios",
+	"Filesystem.ReadBytes":       "bytes",
+	"Filesystem.WriteBytes":      "bytes",
+	"Filesystem.TimeToFull":      "seconds",
+
+	"DiskIo.ReadBytes":  "bytes",
+	"DiskIo.WriteBytes": "bytes",
+	"DiskIo.Reads":      "ios",
+	"DiskIo.Writes":     "ios",
+	"DiskIo.Queued":     "ios",
+
+	"Counters.Reset": "counters",
+	"Cadvisor.Up":    "boolean",
+}
+
+// metricUnit returns the unit of a metric, empty when unknown
+func metricUnit(name string) string {
+	if unit, found := metricUnits[name]; found {
+		return unit
+	}
+	switch {
+	case strings.HasSuffix(name, ".Rate"):
+		if unit := metricUnit(strings.TrimSuffix(name, ".Rate")); unit != "" {
+			return unit + "/s"
+		}
+	case strings.HasSuffix(name, "Percent"):
+		return "percent"
+	case strings.HasSuffix(name, "MB"):
+		return "megabytes"
+	case strings.HasSuffix(name, "Ms"):
+		return "milliseconds"
+	}
+	return ""
+}
+
+// attributes returns the attributes of a metric of subj: what it is about, its unit and the cadvisor it comes from,
+// along with the static attributes of the configuration file. Empty ones are left out.
+func (col *collector) attributes(name string, subj subject) map[string]string {
+	attributes := make(map[string]string, len(col.static)+8)
+	for key, value := range col.static {
+		attributes[key] = value
+	}
+	set := func(key, value string) {
+		if value != "" {
+			attributes[key] = value
+		}
+	}
+	if subj.container != "" {
+		set("cgroup", subj.container)
+		set("container", path.Base(subj.container))
+	}
+	if len(subj.aliases) > 0 {
+		set("alias", subj.aliases[0])
+	}
+	set("namespace", subj.namespace)
+	if subj.k8s != nil {
+		set("k8s_container", subj.k8s.container)
+		set("k8s_pod", subj.k8s.pod)
+		set("k8s_namespace", subj.k8s.namespace)
+		set("k8s_pod_uid", subj.k8s.uid)
+		set("k8s_attempt", strconv.Itoa(subj.k8s.attempt))
+	}
+	set("device", subj.device)
+	set("unit", metricUnit(name))
+	set("endpoint", col.endpoint.address)
+	return attributes
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMetricUnit(t *testing.T) {
+	tests := []struct {
+		name string
+		unit string
+	}{
+		{"Cpu.Imbalance", "percent"},
+		{"Machine.Cpu.Imbalance", "percent"},
+		{"Cpu.Core.UsagePercent", "percent"},
+		{"Machine.Cpu.Core.UsagePercent", "percent"},
+		{"Network.RxBytes.Rate", "bytes/s"},
+		{"Memory.Pgmajfault.Rate", "faults/s"},
+		{"Filesystem.UsageMB", "megabytes"},
+		{"DiskIo.ServiceTimeMs", "milliseconds"},
+		{"Filesystem.TimeToFull", "seconds"},
+		{"Container.Appeared", ""},
+		{"Unknown.Rate", ""},
+	}
+	for _, test := range tests {
+		if unit := metricUnit(test.name); unit != test.unit {
+			t.Errorf("metricUnit(%q) = %q, want %q", test.name, unit, test.unit)
+		}
+	}
+
+	// Every rate has a unit
+	for _, counter := range containerCounters {
+		if metricUnit(counter.name+".Rate") == "" {
+			t.Errorf("%s.Rate has no unit", counter.name)
+		}
+	}
+	for _, counter := range fsCounters {
+		if metricUnit(counter.name+".Rate") == "" {
+			t.Errorf("%s.Rate has no unit", counter.name)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/google/cadvisor/client"
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var cgroupRoot = flag.String("cgroup_root", "", "specify a cgroup (e.g. /system.slice) whose whole hierarchy is monitored along with the docker containers")
+
+// collector turns the stats of a cadvisor into samples, remembering what it
+// needs from one cycle to the next
+type collector struct {
+	client    *client.Client
+	endpoint  endpoint
+	ttl       float32
+	evaluator *evaluator
+	names     *serviceNames
+	devices   *deviceNamer
+	// Static attributes added to every sample
+	static map[string]string
+
+	// When the current cycle started
+	now time.Time
+
+	// Newest stats seen for each container on the previous cycle
+	last map[string]*info.ContainerStats
+
+	// Recent usage of each filesystem, to forecast when it will be full
+	usage map[metricKey]*usageHistory
+
+	// Containers of the previous cycle, nil until the first cycle is over
+	containers map[string]*containerRecord
+}
+
+func newCollector(c *client.Client, e endpoint, ttl float32, rules *thresholdRules, names *serviceNames, static map[string]string) *collector {
+	// Device numbers of a remote cadvisor mean nothing in the device table of this host
+	sysDir := ""
+	if e.local {
+		sysDir = *sysDevBlock
+	}
+	return &collector{
+		client:    c,
+		endpoint:  e,
+		ttl:       ttl,
+		evaluator: newEvaluator(rules),
+		names:     names,
+		devices:   newDeviceNamer(sysDir),
+		static:    static,
+		last:      make(map[string]*info.ContainerStats),
+		usage:     make(map[metricKey]*usageHistory),
+	}
+}
+
+// mergeContainers adds the cgroups that aren't docker containers already to containers
+func mergeContainers(containers []info.ContainerInfo, cgroups []info.ContainerInfo) []info.ContainerInfo {
+	known := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		known[container.Name] = true
+	}
+	for _, cgroup := range cgroups {
+		if !known[cgroup.Name] {
+			containers = append(containers, cgroup)
+		}
+	}
+	return containers
+}
+
+// subject is what a sample is about: a container, one of its devices, or the machine itself
+type subject struct {
+	container string
+	aliases   []string
+	namespace string
+	device    string
+	// Set for the containers of kubernetes pods
+	k8s *k8sPodContainer
+}
+
+func containerSubject(ref *info.ContainerReference) subject {
+	subj := subject{
+		container: ref.Name,
+		aliases:   ref.Aliases,
+		namespace: ref.Namespace,
+	}
+	if len(ref.Aliases) > 0 {
+		subj.k8s, _ = parseK8sName(ref.Aliases[0])
+	}
+	return subj
+}
+
+func deviceSubject(ref *info.ContainerReference, device string) subject {
+	subj := containerSubject(ref)
+	subj.device = device
+	return subj
+}
+
+// label is the name of the subject appended to the service. Devices of the machine
+// are named on their own, devices of a container along with its name.
+func (subj subject) label() string {
+	name := subj.name()
+	switch {
+	case subj.device != "" && name != "":
+		return fmt.Sprintf("%s %s", name, subj.device)
+	case subj.device != "":
+		return subj.device
+	case name != "":
+		return name
+	}
+	return subj.container
+}
+
+// name is the name of the container: namespace/pod/container for the containers of kubernetes pods,
+// its alias otherwise, empty when it has none
+func (subj subject) name() string {
+	switch {
+	case subj.k8s != nil:
+		return subj.k8s.label()
+	case len(subj.aliases) > 0:
+		return subj.aliases[0]
+	}
+	return ""
+}
+
+func (subj subject) tags() []string {
+	if subj.device != "" {
+		return append(append([]string(nil), subj.aliases...), subj.device)
+	}
+	return subj.aliases
+}
+
+// addSample appends a data point to the batch of the current cycle, its state
+// coming from the evaluation of the threshold rule of the metric if there is one
+func (col *collector) addSample(samples []Sample, name string, subj subject, metric interface{}) []Sample {
+	service := col.names.service(name, col.endpoint.host, subj)
+	state, previous, description := col.evaluator.evaluate(name, subj, metric)
+	return append(samples, Sample{
+		Host:        col.endpoint.host,
+		Service:     service,
+		Metric:      metric,
+		Ttl:         col.ttl,
+		Tags:        subj.tags(),
+		State:       state,
+		Description: description,
+		Attributes:  col.attributes(name, subj),
+		Previous:    previous,
+		Name:        name,
+		Container:   subj.container,
+		Aliases:     subj.aliases,
+		Namespace:   subj.namespace,
+		Device:      subj.device,
+		Time:        col.now.Unix(),
+	})
+}
+
+// addFsUsage appends how much of a filesystem is used
+func (col *collector) addFsUsage(samples []Sample, subj subject, fs *info.FsStats) []Sample {
+	samples = col.addSample(samples, "Filesystem.UsageMB", subj, toMegabytes(fs.Usage))
+	samples = col.addSample(samples, "Filesystem.LimitMB", subj, toMegabytes(fs.Limit))
+	if fs.Limit > 0 {
+		samples = col.addSample(samples, "Filesystem.UsagePercent", subj, getFsUsagePercent(fs.Usage, fs.Limit))
+	}
+	return samples
+}
+
+// collect pulls the latest stats out of cadvisor and turns them into samples
+func (col *collector) collect() ([]Sample, error) {
+	var samples []Sample
+	c := col.client
+	seen := make(map[string]*info.ContainerStats)
+	subjects := make(map[string]subject)
+
+	col.now = time.Now()
+	col.evaluator.beginCycle(col.now)
+
+	// Make the call to get all the possible data points
+	request := info.ContainerInfoRequest{
+		NumStats: 10,
+	}
+	returned, err := c.AllDockerContainers(&request)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve machine data: %s", err)
+	}
+	if *cgroupRoot != "" {
+		cgroups, err := c.SubcontainersInfo(*cgroupRoot, &request)
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve the cgroups under %s: %s", *cgroupRoot, err)
+		}
+		returned = mergeContainers(returned, cgroups)
+	}
+
+	machineInfo, err := c.MachineInfo()
+	if err != nil {
+		return nil, fmt.Errorf("unable to getMachineInfo: %s", err)
+	}
+
+	// Machine wide data points
+	machine := subject{}
+	samples = col.addSample(samples, "Machine.Cores", machine, machineInfo.NumCores)
+	samples = col.addSample(samples, "Machine.MemoryMB", machine, toMegabytes(uint64(machineInfo.MemoryCapacity)))
+
+	// Loop into each ContainerInfo
+	// Get stats
+	// Turn them into samples
+	for _, container := range returned {
+		subj := containerSubject(&container.ContainerReference)
+		if subj.k8s != nil && subj.k8s.pause() && *k8sSkipPause {
+			continue
+		}
+		// A container is still there without stats, as happens right after it started
+		subjects[container.Name] = subj
+		if len(container.Stats) == 0 {
+			continue
+		}
+		if restarted(col.last[container.Name], container.Stats) {
+			samples = col.addRestarted(samples, subj)
+		}
+		samples = col.addSample(samples, "Cpu.Load", subj, int(container.Stats[0].Cpu.LoadAverage))
+
+		samples = col.addSample(samples, "Cpu.Usage.Total", subj, int(container.Stats[0].Cpu.Usage.Total))
+
+		cpuUsagePercent := getCpuTotalPercent(&container.Spec, container.Stats, machineInfo)
+		samples = col.addSample(samples, "Cpu.Usage.TotalPercent", subj, cpuUsagePercent)
+
+		samples = col.addSample(samples, "Cpu.Usage.User", subj, int(container.Stats[0].Cpu.Usage.User))
+		samples = col.addSample(samples, "Cpu.Usage.System", subj, int(container.Stats[0].Cpu.Usage.System))
+
+		samples = col.addSample(samples, "Memory.UsageMB", subj, getMemoryUsage(container.Stats))
+
+		// Cgroups without a memory controller have no limit to take a percentage of
+		if memoryLimit(&container.Spec, machineInfo) > 0 {
+			memoryUsagePercent := getMemoryUsagePercent(&container.Spec, container.Stats, machineInfo)
+			samples = col.addSample(samples, "Memory.UsagePercent", subj, memoryUsagePercent)
+
+			samples = col.addSample(samples, "Memory.UsageHotPercent", subj, getHotMemoryPercent(&container.Spec, container.Stats, machineInfo))
+			samples = col.addSample(samples, "Memory.UsageColdPercent", subj, getColdMemoryPercent(&container.Spec, container.Stats, machineInfo))
+		}
+
+		samples = col.addSample(samples, "Network.RxBytes", subj, int(container.Stats[0].Network.RxBytes))
+		samples = col.addSample(samples, "Network.RxPackets", subj, int(container.Stats[0].Network.RxPackets))
+		samples = col.addSample(samples, "Network.RxErrors", subj, int(container.Stats[0].Network.RxErrors))
+		samples = col.addSample(samples, "Network.RxDropped", subj, int(container.Stats[0].Network.RxDropped))
+		samples = col.addSample(samples, "Network.TxBytes", subj, int(container.Stats[0].Network.TxBytes))
+		samples = col.addSample(samples, "Network.TxPackets", subj, int(container.Stats[0].Network.TxPackets))
+		samples = col.addSample(samples, "Network.TxErrors", subj, int(container.Stats[0].Network.TxErrors))
+		samples = col.addSample(samples, "Network.TxDropped", subj, int(container.Stats[0].Network.TxDropped))
+
+		// Usage of the filesystems of the container (its writable layer, volumes...)
+		for _, fs := range container.Stats[len(container.Stats)-1].Filesystem {
+			fsSubj := deviceSubject(&container.ContainerReference, fs.Device)
+			samples = col.addFsUsage(samples, fsSubj, &fs)
+			samples = col.addTimeToFull(samples, fsSubj, container.Stats, &fs)
+		}
+
+		// Per-second rates of the cumulative counters, since the previous cycle when possible
+		if from, to := rateWindow(col.last[container.Name], container.Stats); from != nil {
+			var resets []string
+			for _, counter := range containerCounters {
+				rate, reset, ok := counterRate(counter.value(from), counter.value(to), to.Timestamp.Sub(from.Timestamp))
+				if reset {
+					resets = append(resets, counter.name)
+				}
+				if ok {
+					samples = col.addSample(samples, counter.name+".Rate", subj, rate)
+				}
+			}
+			samples = col.addCounterResets(samples, subj, resets)
+			samples = col.addDiskIo(samples, &container.ContainerReference, from, to)
+			samples = col.addPerCpu(samples, "Cpu", subj, from, to)
+		}
+		seen[container.Name] = container.Stats[len(container.Stats)-1]
+	}
+
+	returnedFS, err := c.ContainerInfo("/", nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to ContainerInfo: %s", err)
+	}
+	// The root container has no stats yet right after cadvisor started
+	if len(returnedFS.Stats) > 0 {
+		samples = col.addMachineFs(samples, returnedFS, machine)
+		seen[returnedFS.Name] = returnedFS.Stats[len(returnedFS.Stats)-1]
+	}
+
+	samples = col.addLifecycle(samples, subjects)
+
+	// Forget about the containers that went away
+	col.last = seen
+	col.forgetUsage()
+	col.evaluator.endCycle()
+
+	return samples, nil
+}
+
+// addMachineFs appends the per-CPU usage of the machine and the usage, rates and
+// forecasts of its filesystems, out of the stats of the root container
+func (col *collector) addMachineFs(samples []Sample, returnedFS *info.ContainerInfo, machine subject) []Sample {
+	containerStats := returnedFS.Stats[0]
+	from, to := rateWindow(col.last[returnedFS.Name], returnedFS.Stats)
+	if from != nil {
+		samples = col.addPerCpu(samples, "Machine.Cpu", machine, from, to)
+	}
+	for _, fs := range containerStats.Filesystem {
+		subj := deviceSubject(&returnedFS.ContainerReference, fs.Device)
+		samples = col.addFsUsage(samples, subj, &fs)
+		samples = col.addTimeToFull(samples, subj, returnedFS.Stats, &fs)
+
+		if from == nil {
+			continue
+		}
+		fromFs, toFs := findFsStats(from, fs.Device), findFsStats(to, fs.Device)
+		if fromFs == nil || toFs == nil {
+			continue
+		}
+		var resets []string
+		for _, counter := range fsCounters {
+			rate, reset, ok := counterRate(counter.value(fromFs), counter.value(toFs), to.Timestamp.Sub(from.Timestamp))
+			if reset {
+				resets = append(resets, counter.name)
+			}
+			if ok {
+				samples = col.addSample(samples, counter.name+".Rate", subj, rate)
+			}
+		}
+		samples = col.addCounterResets(samples, subj, resets)
+		samples = col.addFsIostat(samples, subj, fromFs, toFs, to.Timestamp.Sub(from.Timestamp))
+	}
+	return samples
+}
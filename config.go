@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var configFile = flag.String("config", "", "specify a JSON configuration file (default '', none)")
+
+// config is what the configuration file sets beyond flags
+type config struct {
+	rules *thresholdRules
+	// Service templates, by metric name
+	services map[string]string
+	// Static attributes added to every event, e.g. environment or datacenter
+	attributes map[string]string
+}
+
+// loadConfig reads a JSON configuration file and returns its threshold rules, overrides, service templates and attributes.
+// Every other key of the file is the name of a flag, for instance riemann_address,
+// and sets it unless it was also given on the command line.
+func loadConfig(path string) (*config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var settings map[string]json.RawMessage
+	if err = json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", path, err)
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	rules := &thresholdRules{defaults: make(thresholds)}
+	var services, attributes map[string]string
+	for key, raw := range settings {
+		switch key {
+		case "thresholds":
+			if err = json.Unmarshal(raw, &rules.defaults); err != nil {
+				return nil, fmt.Errorf("invalid thresholds: %s", err)
+			}
+			continue
+		case "overrides":
+			if err = json.Unmarshal(raw, &rules.overrides); err != nil {
+				return nil, fmt.Errorf("invalid overrides: %s", err)
+			}
+			continue
+		case "service_templates":
+			if err = json.Unmarshal(raw, &services); err != nil {
+				return nil, fmt.Errorf("invalid service_templates: %s", err)
+			}
+			continue
+		case "attributes":
+			if err = json.Unmarshal(raw, &attributes); err != nil {
+				return nil, fmt.Errorf("invalid attributes: %s", err)
+			}
+			continue
+		}
+		if key == "config" || flag.Lookup(key) == nil {
+			return nil, fmt.Errorf("unknown setting %q", key)
+		}
+		if explicit[key] {
+			continue
+		}
+		value, err := configValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", key, err)
+		}
+		if err = flag.Set(key, value); err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", key, err)
+		}
+	}
+
+	for name, rule := range rules.defaults {
+		if err = rule.validate(); err != nil {
+			return nil, fmt.Errorf("invalid threshold of %s: %s", name, err)
+		}
+	}
+	for i, override := range rules.overrides {
+		if override == nil {
+			return nil, fmt.Errorf("invalid override #%d: no override", i+1)
+		}
+		if err = override.validate(); err != nil {
+			return nil, fmt.Errorf("invalid override #%d: %s", i+1, err)
+		}
+	}
+	return &config{rules: rules, services: services, attributes: attributes}, nil
+}
+
+// configValue turns a JSON string, number or boolean into a flag value,
+// a list of strings being joined with commas
+func configValue(raw json.RawMessage) (string, error) {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", err
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("expected a list of strings, got %s", raw)
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", fmt.Errorf("expected a string, a number or a boolean, got %s", raw)
+}
+
+// duration is a time.Duration read from a JSON string such as "30s"
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigRejectsInvalidRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{`{"thresholds": {"Cpu.Usage.TotalPercent": null}}`, "invalid threshold of Cpu.Usage.TotalPercent"},
+		{`{"thresholds": {"Cpu.Usage.TotalPercent": {"warning": 90, "critical": 80}}}`, "invalid threshold of Cpu.Usage.TotalPercent"},
+		{`{"overrides": [null]}`, "invalid override #1"},
+		{`{"overrides": [{"name": "/docker/*", "thresholds": {"Memory.UsagePercent": null}}]}`, "invalid override #1: invalid threshold of Memory.UsagePercent"},
+		{`{"overrides": [{"thresholds": {}}]}`, "invalid override #1"},
+		{`{"no_such_flag": 1}`, "unknown setting"},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, "config.json")
+		if err := ioutil.WriteFile(path, []byte(test.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadConfig(path)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("loadConfig(%s) = %v, want an error with %q", test.config, err, test.err)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+	data := `{
+		"thresholds": {"Cpu.Usage.TotalPercent": {"warning": 80, "critical": 90}},
+		"overrides": [{"alias": "batch-*", "thresholds": {"Cpu.Usage.TotalPercent": {"critical": 101}}}],
+		"attributes": {"environment": "production"}
+	}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule := cfg.rules.defaults["Cpu.Usage.TotalPercent"]; rule == nil || *rule.Warning != 80 || *rule.Critical != 90 {
+		t.Errorf("Cpu.Usage.TotalPercent rule = %+v, want warning 80 and critical 90", rule)
+	}
+	if len(cfg.rules.overrides) != 1 || cfg.attributes["environment"] != "production" {
+		t.Errorf("loaded %d overrides and attributes %v", len(cfg.rules.overrides), cfg.attributes)
+	}
+}
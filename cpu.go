@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// perCpuPercent returns how busy each core was between from and to, in percent,
+// nil when the cores can't be compared (their number changed, or a counter was reset)
+func perCpuPercent(from, to *info.ContainerStats) []float64 {
+	if len(from.Cpu.Usage.PerCpu) != len(to.Cpu.Usage.PerCpu) {
+		return nil
+	}
+	interval := float64(to.Timestamp.Sub(from.Timestamp).Nanoseconds())
+	if interval <= 0 {
+		return nil
+	}
+	usage := make([]float64, len(to.Cpu.Usage.PerCpu))
+	for i := range to.Cpu.Usage.PerCpu {
+		delta, reset, ok := counterDelta(from.Cpu.Usage.PerCpu[i], to.Cpu.Usage.PerCpu[i])
+		if reset || !ok {
+			return nil
+		}
+		usage[i] = roundDecimals(float64(delta)/interval*100, 2)
+		if usage[i] > 100 {
+			usage[i] = 100
+		}
+	}
+	return usage
+}
+
+// cpuImbalance is how much busier the busiest core is than the average of the
+// others, in percent: close to 100 for a single threaded workload pegging a core
+// while the others sit idle, close to 0 when the load is spread evenly.
+func cpuImbalance(usage []float64) float64 {
+	if len(usage) < 2 {
+		return 0
+	}
+	busiest, total := 0, float64(0)
+	for i, u := range usage {
+		if u > usage[busiest] {
+			busiest = i
+		}
+		total += u
+	}
+	others := (total - usage[busiest]) / float64(len(usage)-1)
+	return roundDecimals(usage[busiest]-others, 2)
+}
+
+// addPerCpu appends the usage of each core between from and to as <prefix>.Core.UsagePercent,
+// along with their <prefix>.Imbalance
+func (col *collector) addPerCpu(samples []Sample, prefix string, subj subject, from, to *info.ContainerStats) []Sample {
+	usage := perCpuPercent(from, to)
+	if usage == nil {
+		return samples
+	}
+	for i, u := range usage {
+		core := subj
+		core.device = fmt.Sprintf("cpu%d", i)
+		samples = col.addSample(samples, prefix+".Core.UsagePercent", core, u)
+	}
+	return col.addSample(samples, prefix+".Imbalance", subj, cpuImbalance(usage))
+}
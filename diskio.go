@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var sysDevBlock = flag.String("sys_dev_block", "/sys/dev/block", "specify where major:minor device numbers of a local cadvisor are resolved to device names, e.g. /host/sys/dev/block when running inside a container, '' to disable")
+
+// diskKey identifies a block device by its major and minor numbers
+type diskKey struct {
+	major uint64
+	minor uint64
+}
+
+// diskIoStats indexes the per device stats of a blkio file by device
+func diskIoStats(perDisk []info.PerDiskStats) map[diskKey]map[string]uint64 {
+	stats := make(map[diskKey]map[string]uint64, len(perDisk))
+	for _, disk := range perDisk {
+		stats[diskKey{disk.Major, disk.Minor}] = disk.Stats
+	}
+	return stats
+}
+
+// deviceNamer resolves device numbers to names against the device table of a host,
+// caching the names of the block devices, which don't change while they exist
+type deviceNamer struct {
+	mu    sync.Mutex
+	dir   string
+	names map[diskKey]string
+}
+
+// newDeviceNamer resolves names under dir, an empty dir leaving devices named major:minor
+func newDeviceNamer(dir string) *deviceNamer {
+	return &deviceNamer{dir: dir, names: make(map[diskKey]string)}
+}
+
+// name resolves a device number to its name (/sys/dev/block/8:0 links to .../block/sda),
+// falling back to major:minor when it can't be resolved
+func (n *deviceNamer) name(key diskKey) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if name, found := n.names[key]; found {
+		return name
+	}
+
+	name := fmt.Sprintf("%d:%d", key.major, key.minor)
+	if n.dir == "" {
+		return name
+	}
+	if target, err := os.Readlink(filepath.Join(n.dir, name)); err == nil {
+		name = filepath.Base(target)
+		n.names[key] = name
+	}
+	return name
+}
+
+// addDiskIo appends the block I/O throughput, IOPS and latencies of each device of a container between from and to
+func (col *collector) addDiskIo(samples []Sample, ref *info.ContainerReference, from, to *info.ContainerStats) []Sample {
+	interval := to.Timestamp.Sub(from.Timestamp)
+	fromBytes, toBytes := diskIoStats(from.DiskIo.IoServiceBytes), diskIoStats(to.DiskIo.IoServiceBytes)
+	fromServiced, toServiced := diskIoStats(from.DiskIo.IoServiced), diskIoStats(to.DiskIo.IoServiced)
+	fromServiceTime, toServiceTime := diskIoStats(from.DiskIo.IoServiceTime), diskIoStats(to.DiskIo.IoServiceTime)
+	fromWaitTime, toWaitTime := diskIoStats(from.DiskIo.IoWaitTime), diskIoStats(to.DiskIo.IoWaitTime)
+	queued := diskIoStats(to.DiskIo.IoQueued)
+
+	for _, disk := range to.DiskIo.IoServiced {
+		key := diskKey{disk.Major, disk.Minor}
+		subj := deviceSubject(ref, col.devices.name(key))
+		var resets []string
+
+		// Throughput and IOPS
+		for _, op := range []string{"Read", "Write"} {
+			counters := []struct {
+				name     string
+				from, to map[string]uint64
+			}{
+				{"DiskIo." + op + "Bytes", fromBytes[key], toBytes[key]},
+				{"DiskIo." + op + "s", fromServiced[key], toServiced[key]},
+			}
+			for _, counter := range counters {
+				if counter.from == nil || counter.to == nil {
+					continue
+				}
+				rate, reset, ok := counterRate(counter.from[op], counter.to[op], interval)
+				if reset {
+					resets = append(resets, counter.name)
+				}
+				if ok {
+					samples = col.addSample(samples, counter.name+".Rate", subj, rate)
+				}
+			}
+		}
+
+		// Average time spent by each I/O of the interval being serviced, and waiting in the scheduler queues
+		// (intervals with a reset are skipped, a rebased latency would be meaningless)
+		if prev, found := fromServiced[key]; found {
+			if ios, reset, _ := counterDelta(prev["Total"], disk.Stats["Total"]); !reset && ios > 0 {
+				if delta, reset, ok := timeDelta(fromServiceTime[key], toServiceTime[key]); ok && !reset {
+					samples = col.addSample(samples, "DiskIo.ServiceTimeMs", subj, nanosecondsPerIo(delta, ios))
+				}
+				if delta, reset, ok := timeDelta(fromWaitTime[key], toWaitTime[key]); ok && !reset {
+					samples = col.addSample(samples, "DiskIo.WaitTimeMs", subj, nanosecondsPerIo(delta, ios))
+				}
+			}
+		}
+
+		if stats, found := queued[key]; found {
+			samples = col.addSample(samples, "DiskIo.Queued", subj, int(stats["Total"]))
+		}
+		samples = col.addCounterResets(samples, subj, resets)
+	}
+	return samples
+}
+
+// timeDelta is the time cumulated by all the I/Os of a device, see counterDelta
+func timeDelta(from, to map[string]uint64) (delta uint64, reset bool, ok bool) {
+	if from == nil || to == nil {
+		return 0, false, false
+	}
+	return counterDelta(from["Total"], to["Total"])
+}
+
+// nanosecondsPerIo turns a cumulated time in nanoseconds into an average per I/O, in milliseconds
+func nanosecondsPerIo(nanoseconds uint64, ios uint64) float64 {
+	return roundDecimals(float64(nanoseconds)/float64(ios)/1e6, 3)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+var flapWindow = flag.Int("flap_window", 20, "specify over how many cycles state changes are counted to detect flapping, 0 to disable (default 20)")
+var flapHigh = flag.Float64("flap_high", 50, "specify the percentage of cycles with a state change above which a metric is flapping (default 50)")
+var flapLow = flag.Float64("flap_low", 25, "specify the percentage of cycles with a state change below which a metric stops flapping (default 25)")
+
+// metricKey identifies a metric of a container, or of one of its devices
+type metricKey struct {
+	container string
+	device    string
+	name      string
+}
+
+// metricState is what the evaluator remembers about a metric between cycles
+type metricState struct {
+	state string
+
+	// State the metric is heading to, and since when, while it has to hold
+	pending       string
+	pendingSince  time.Time
+	pendingCycles int
+
+	// State given by the rule on the previous cycle, and whether it changed over the last cycles
+	raw      string
+	changes  []bool
+	flapping bool
+
+	// State returned on the previous cycle, flapping included
+	reported string
+
+	cycle int
+}
+
+// flapRate records whether the state given by the rule changed, and returns the percentage
+// of cycles of the flap window with a change
+func (ms *metricState) flapRate(raw string) float64 {
+	ms.changes = append(ms.changes, ms.raw != "" && raw != ms.raw)
+	ms.raw = raw
+	if len(ms.changes) > *flapWindow {
+		ms.changes = ms.changes[len(ms.changes)-*flapWindow:]
+	}
+
+	count := 0
+	for _, changed := range ms.changes {
+		if changed {
+			count++
+		}
+	}
+	return float64(count*100) / float64(*flapWindow)
+}
+
+// evaluator computes the state of each metric from its threshold rule, remembering
+// the reported states so that they only change when the rule says so
+type evaluator struct {
+	rules  *thresholdRules
+	states map[metricKey]*metricState
+	cycle  int
+	now    time.Time
+}
+
+func newEvaluator(rules *thresholdRules) *evaluator {
+	return &evaluator{
+		rules:  rules,
+		states: make(map[metricKey]*metricState),
+	}
+}
+
+func (e *evaluator) beginCycle(now time.Time) {
+	e.cycle++
+	e.now = now
+}
+
+// endCycle forgets about the metrics that were not evaluated during the cycle
+func (e *evaluator) endCycle() {
+	for key, ms := range e.states {
+		if ms.cycle != e.cycle {
+			delete(e.states, key)
+		}
+	}
+}
+
+// evaluate returns the state of a metric of subj, or an empty state when the metric has no rule.
+// previous is the state returned on the previous cycle when it changed, empty otherwise.
+func (e *evaluator) evaluate(name string, subj subject, metric interface{}) (state string, previous string, description string) {
+	rule := e.rules.rule(name, subj)
+	if rule == nil {
+		return "", "", ""
+	}
+	value, ok := metricValue(metric)
+	if !ok {
+		return "", "", ""
+	}
+
+	key := metricKey{container: subj.container, device: subj.device, name: name}
+	ms, found := e.states[key]
+	if !found {
+		ms = &metricState{state: "ok"}
+		e.states[key] = ms
+	}
+	ms.cycle = e.cycle
+
+	state, description = e.judge(rule, ms, value)
+	if ms.reported != "" && ms.reported != state {
+		previous = ms.reported
+	}
+	ms.reported = state
+	return state, previous, description
+}
+
+// judge applies rule to value. A metric changing state too often is flapping,
+// its state is then held until it settles down.
+func (e *evaluator) judge(rule *ThresholdRule, ms *metricState, value float64) (state string, description string) {
+	target := rule.state(value, ms.state)
+	if *flapWindow > 0 {
+		rate := ms.flapRate(target)
+		switch {
+		case !ms.flapping && rate >= *flapHigh:
+			ms.flapping = true
+		case ms.flapping && rate < *flapLow:
+			ms.flapping = false
+		}
+		if ms.flapping {
+			ms.pending = ""
+			return "flapping", fmt.Sprintf("flapping: state changed on %.0f%% of the last %d cycles, holding %s", rate, *flapWindow, ms.state)
+		}
+	}
+
+	switch {
+	case target == ms.state:
+		ms.pending = ""
+		return ms.state, ""
+	case target != ms.pending:
+		ms.pending = target
+		ms.pendingSince = e.now
+		ms.pendingCycles = 0
+	}
+	ms.pendingCycles++
+
+	if ms.pendingCycles >= rule.ForCycles && e.now.Sub(ms.pendingSince) >= time.Duration(rule.For) {
+		ms.state = target
+		ms.pending = ""
+	}
+	return ms.state, ""
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// evaluateSeries evaluates values as successive cycles, interval apart, and returns the states
+func evaluateSeries(rule *ThresholdRule, values []float64, interval time.Duration) []string {
+	e := newEvaluator(&thresholdRules{defaults: thresholds{"M": rule}})
+	subj := subject{container: "/docker/web"}
+	now := time.Unix(0, 0)
+	var states []string
+	for _, value := range values {
+		e.beginCycle(now)
+		state, _, _ := e.evaluate("M", subj, value)
+		e.endCycle()
+		states = append(states, state)
+		now = now.Add(interval)
+	}
+	return states
+}
+
+func sameStates(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEvaluatorHold(t *testing.T) {
+	defer func(window int) { *flapWindow = window }(*flapWindow)
+	*flapWindow = 0
+
+	tests := []struct {
+		rule   *ThresholdRule
+		values []float64
+		want   []string
+	}{
+		// Hysteresis: the warning holds until the value gets under the clear level
+		{
+			&ThresholdRule{Warning: level(80), WarningClear: level(70)},
+			[]float64{50, 85, 75, 72, 65},
+			[]string{"ok", "warning", "warning", "warning", "ok"},
+		},
+		// A new state must hold for 3 cycles, a blip resets the count
+		{
+			&ThresholdRule{Warning: level(80), ForCycles: 3},
+			[]float64{85, 85, 50, 85, 85, 85, 50},
+			[]string{"ok", "ok", "ok", "ok", "ok", "warning", "warning"},
+		},
+		// A new state must hold for 20s, cycles being 10s apart
+		{
+			&ThresholdRule{Warning: level(80), For: duration(20 * time.Second)},
+			[]float64{85, 85, 85, 50, 50, 50},
+			[]string{"ok", "ok", "warning", "warning", "warning", "ok"},
+		},
+	}
+	for i, test := range tests {
+		if got := evaluateSeries(test.rule, test.values, 10*time.Second); !sameStates(got, test.want) {
+			t.Errorf("#%d: states of %v = %v, want %v", i, test.values, got, test.want)
+		}
+	}
+}
+
+func TestEvaluatorFlapping(t *testing.T) {
+	defer func(window int, high, low float64) {
+		*flapWindow, *flapHigh, *flapLow = window, high, low
+	}(*flapWindow, *flapHigh, *flapLow)
+	*flapWindow, *flapHigh, *flapLow = 4, 50, 25
+
+	// Flapping once the state changed on 2 of the last 4 cycles, until it didn't change on any
+	rule := &ThresholdRule{Warning: level(80)}
+	values := []float64{50, 85, 50, 85, 50, 50, 50, 50, 50}
+	want := []string{"ok", "warning", "flapping", "flapping", "flapping", "flapping", "flapping", "flapping", "ok"}
+	if got := evaluateSeries(rule, values, 10*time.Second); !sameStates(got, want) {
+		t.Errorf("states of %v = %v, want %v", values, got, want)
+	}
+}
+
+func TestEvaluatorPrevious(t *testing.T) {
+	defer func(window int) { *flapWindow = window }(*flapWindow)
+	*flapWindow = 0
+
+	e := newEvaluator(&thresholdRules{defaults: thresholds{"M": {Warning: level(80)}}})
+	subj := subject{container: "/docker/web"}
+	var previous []string
+	for _, value := range []float64{50, 85, 90, 50} {
+		e.beginCycle(time.Now())
+		_, p, _ := e.evaluate("M", subj, value)
+		previous = append(previous, p)
+	}
+	if want := []string{"", "ok", "", "warning"}; !sameStates(previous, want) {
+		t.Errorf("previous states = %v, want %v", previous, want)
+	}
+
+	// Metrics without a rule get no state
+	if state, _, _ := e.evaluate("Other", subj, 99); state != "" {
+		t.Errorf("state of a metric without rule = %q, want none", state)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/cadvisor/client"
+)
+
+var cadvisorTimeout = flag.Duration("cadvisor_timeout", 10*time.Second, "specify the time allowed for a cadvisor to answer (default 10s)")
+
+// endpoint is a cadvisor to poll, along with the host its events are about
+type endpoint struct {
+	host    string
+	address string
+	// Whether the cadvisor runs on this host, sharing its device table
+	local bool
+}
+
+// parseEndpoints reads a comma separated list of cadvisor addresses, each one optionally
+// prefixed with the host of its events: "node1=http://10.0.0.1:8080,node2=http://10.0.0.2:8080".
+// Without a prefix, a single cadvisor uses defaultHost, several use the host of their address.
+// Hosts must be unique, as the events of a host are told apart by their service only.
+func parseEndpoints(spec string, defaultHost string) ([]endpoint, error) {
+	var endpoints []endpoint
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var e endpoint
+		if i := strings.Index(item, "="); i >= 0 && !strings.Contains(item[:i], "/") {
+			e.host, e.address = item[:i], item[i+1:]
+		} else {
+			e.address = item
+		}
+		endpoints = append(endpoints, e)
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no cadvisor address")
+	}
+
+	for i := range endpoints {
+		e := &endpoints[i]
+		e.local = len(endpoints) == 1 || isLoopback(e.address)
+		switch {
+		case e.host != "":
+		case len(endpoints) == 1:
+			e.host = defaultHost
+		default:
+			u, err := url.Parse(e.address)
+			if err != nil || u.Host == "" {
+				return nil, fmt.Errorf("invalid cadvisor address %q", e.address)
+			}
+			e.host = u.Hostname()
+		}
+	}
+
+	// Events of two cadvisors on the same host would collide
+	hosts := make(map[string]string, len(endpoints))
+	for _, e := range endpoints {
+		if other, found := hosts[e.host]; found {
+			return nil, fmt.Errorf("cadvisors %s and %s both have host %q, name them with host=address", other, e.address, e.host)
+		}
+		hosts[e.host] = e.address
+	}
+	return endpoints, nil
+}
+
+// isLoopback tells whether address points to this host
+func isLoopback(address string) bool {
+	u, err := url.Parse(address)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// poller polls a cadvisor on its own, so that one being slow or unreachable
+// doesn't hold up the others
+type poller struct {
+	endpoint  endpoint
+	collector *collector
+	failures  int
+}
+
+func newPoller(e endpoint, ttl float32, rules *thresholdRules, names *serviceNames, static map[string]string) (*poller, error) {
+	c, err := client.NewClient(e.address)
+	if err != nil {
+		return nil, err
+	}
+	return &poller{
+		endpoint:  e,
+		collector: newCollector(c, e, ttl, rules, names, static),
+	}, nil
+}
+
+// run polls the cadvisor every interval until stop is closed
+func (p *poller) run(interval time.Duration, sink Sink, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.poll(sink)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// poll collects a cycle and hands it over to sink, along with whether the cadvisor could be reached
+func (p *poller) poll(sink Sink) {
+	samples, err := p.collect()
+	if err != nil {
+		p.failures++
+		glog.Errorf("cadvisor %s (%d failures in a row): %s", p.endpoint.address, p.failures, err)
+		sink.Emit([]Sample{p.upSample(err)})
+		return
+	}
+	if p.failures > 0 {
+		glog.Infof("cadvisor %s is back after %d failures", p.endpoint.address, p.failures)
+		p.failures = 0
+	}
+	sink.Emit(append(samples, p.upSample(nil)))
+}
+
+// collect collects a cycle, turning a panic on unexpected data of the cadvisor into
+// an error of this cadvisor alone, the others being polled on
+func (p *poller) collect() (samples []Sample, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			glog.Errorf("cadvisor %s: panic while collecting: %v\n%s", p.endpoint.address, r, debug.Stack())
+			samples, err = nil, fmt.Errorf("unable to collect: %v", r)
+		}
+	}()
+	return p.collector.collect()
+}
+
+// upSample reports whether the last poll succeeded
+func (p *poller) upSample(err error) Sample {
+	sample := Sample{
+		Host:       p.endpoint.host,
+		Service:    p.collector.names.service("Cadvisor.Up", p.endpoint.host, subject{}),
+		Metric:     1,
+		Ttl:        p.collector.ttl,
+		State:      "ok",
+		Attributes: p.collector.attributes("Cadvisor.Up", subject{}),
+		Time:       time.Now().Unix(),
+		Name:       "Cadvisor.Up",
+	}
+	if err != nil {
+		sample.Metric = 0
+		sample.State = "critical"
+		sample.Description = fmt.Sprintf("%s: %s", p.endpoint.address, err)
+	}
+	return sample
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []endpoint
+	}{
+		{"http://localhost:8080", []endpoint{{"default", "http://localhost:8080", true}}},
+		{"http://10.0.0.1:8080", []endpoint{{"default", "http://10.0.0.1:8080", true}}},
+		{"node1=http://10.0.0.1:8080", []endpoint{{"node1", "http://10.0.0.1:8080", true}}},
+		{
+			"node1=http://10.0.0.1:8080, http://10.0.0.2:8080,http://127.0.0.1:8080",
+			[]endpoint{
+				{"node1", "http://10.0.0.1:8080", false},
+				{"10.0.0.2", "http://10.0.0.2:8080", false},
+				{"127.0.0.1", "http://127.0.0.1:8080", true},
+			},
+		},
+		// An equal sign after a slash is part of the address
+		{"http://proxy/cadvisor?node=a", []endpoint{{"default", "http://proxy/cadvisor?node=a", true}}},
+		{"a=http://a:8080,b=http://a:8081", []endpoint{{"a", "http://a:8080", false}, {"b", "http://a:8081", false}}},
+		// Errors: nothing to poll, two cadvisors sharing a host, an address without host
+		{"", nil},
+		{"http://a:8080,http://a:8081", nil},
+		{"a=http://a:8080,a=http://b:8080", nil},
+		{"http://a:8080,b:8080", nil},
+	}
+	for _, test := range tests {
+		got, err := parseEndpoints(test.spec, "default")
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("parseEndpoints(%q) = %v, want an error", test.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseEndpoints(%q) failed: %s", test.spec, err)
+			continue
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("parseEndpoints(%q) = %v, want %v", test.spec, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("parseEndpoints(%q)[%d] = %+v, want %+v", test.spec, i, got[i], test.want[i])
+			}
+		}
+	}
+}
+
+// recordingSink keeps the batches emitted to it
+type recordingSink struct {
+	batches [][]Sample
+}
+
+func (s *recordingSink) Emit(samples []Sample) error {
+	s.batches = append(s.batches, samples)
+	return nil
+}
+
+func (s *recordingSink) Flush() error { return nil }
+func (s *recordingSink) Close() error { return nil }
+
+// fakeCadvisor serves the docker containers returned by containers, and the root container as given
+func fakeCadvisor(containers func() []info.ContainerInfo, root info.ContainerInfo) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1.2/machine", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(info.MachineInfo{NumCores: 2, MemoryCapacity: 1 << 30})
+	})
+	mux.HandleFunc("/api/v1.2/docker/", func(w http.ResponseWriter, r *http.Request) {
+		docker := make(map[string]info.ContainerInfo)
+		for _, container := range containers() {
+			docker[container.Name] = container
+		}
+		json.NewEncoder(w).Encode(docker)
+	})
+	mux.HandleFunc("/api/v1.2/containers/", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(root)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestPollRootWithoutStats(t *testing.T) {
+	containers := func() []info.ContainerInfo {
+		return []info.ContainerInfo{{
+			ContainerReference: info.ContainerReference{Name: "/docker/aaaaaa", Aliases: []string{"web"}},
+			Stats:              []*info.ContainerStats{{Timestamp: time.Now()}},
+		}}
+	}
+	server := fakeCadvisor(containers, info.ContainerInfo{ContainerReference: info.ContainerReference{Name: "/"}})
+	defer server.Close()
+	names, err := newServiceNames("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := newPoller(endpoint{host: "node1", address: server.URL}, 20, &thresholdRules{defaults: make(thresholds)}, names, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &recordingSink{}
+	p.poll(sink)
+	if len(sink.batches) != 1 {
+		t.Fatalf("poll emitted %d batches, want 1", len(sink.batches))
+	}
+	batch := sink.batches[0]
+	up := batch[len(batch)-1]
+	if up.Name != "Cadvisor.Up" || up.Metric != 1 {
+		t.Errorf("last sample is %s %v (%s), want Cadvisor.Up 1", up.Name, up.Metric, up.Description)
+	}
+	found := false
+	for _, sample := range batch {
+		found = found || sample.Name == "Memory.UsageMB" && sample.Container == "/docker/aaaaaa"
+	}
+	if !found {
+		t.Errorf("no Memory.UsageMB of /docker/aaaaaa in %d samples", len(batch))
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var forecastWindow = flag.Duration("forecast_window", time.Hour, "specify how much filesystem usage history the disk full forecast is fitted on (default 1h)")
+var timeToFullWarning = flag.Duration("time_to_full_warning", 24*time.Hour, "specify the forecast time to full under which a filesystem is in warning (default 24h)")
+var timeToFullCritical = flag.Duration("time_to_full_critical", time.Hour, "specify the forecast time to full under which a filesystem is critical (default 1h)")
+
+// minForecastPoints is how many usage points a forecast needs at least
+const minForecastPoints = 3
+
+// minForecastSpan is the share of -forecast_window the history must cover before a forecast is made,
+// so that a short burst of writes, such as within the stats window of the first cycle, raises no alert
+const minForecastSpan = 4
+
+type usagePoint struct {
+	time  time.Time
+	usage float64
+}
+
+// usageHistory is the recent usage of a filesystem, oldest first
+type usageHistory struct {
+	points []usagePoint
+	seen   time.Time
+}
+
+// record adds the usage of device found in stats since the newest point, then forgets about the points beyond the window
+func (h *usageHistory) record(stats []*info.ContainerStats, device string, now time.Time) {
+	for _, s := range stats {
+		fs := findFsStats(s, device)
+		if fs == nil || (len(h.points) > 0 && !s.Timestamp.After(h.points[len(h.points)-1].time)) {
+			continue
+		}
+		h.points = append(h.points, usagePoint{s.Timestamp, float64(fs.Usage)})
+	}
+	oldest := now.Add(-*forecastWindow)
+	for len(h.points) > 0 && h.points[0].time.Before(oldest) {
+		h.points = h.points[1:]
+	}
+	h.seen = now
+}
+
+// growth fits a line to the history by least squares and returns its slope, in bytes per second,
+// ok being false until the history covers a quarter of the forecast window
+func (h *usageHistory) growth() (float64, bool) {
+	n := float64(len(h.points))
+	if len(h.points) < minForecastPoints {
+		return 0, false
+	}
+	if h.points[len(h.points)-1].time.Sub(h.points[0].time) < *forecastWindow/minForecastSpan {
+		return 0, false
+	}
+	origin := h.points[0].time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, p := range h.points {
+		x := p.time.Sub(origin).Seconds()
+		sumX += x
+		sumY += p.usage
+		sumXY += x * p.usage
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / denominator, true
+}
+
+// addTimeToFull appends in how many seconds the filesystem of subj will be full at its current growth rate.
+// Filesystems that are stable or shrinking get no forecast.
+func (col *collector) addTimeToFull(samples []Sample, subj subject, stats []*info.ContainerStats, fs *info.FsStats) []Sample {
+	key := metricKey{container: subj.container, device: subj.device}
+	h, found := col.usage[key]
+	if !found {
+		h = &usageHistory{}
+		col.usage[key] = h
+	}
+	h.record(stats, fs.Device, col.now)
+
+	growth, ok := h.growth()
+	if !ok || growth <= 0 || fs.Limit == 0 {
+		return samples
+	}
+	free := math.Max(float64(fs.Limit)-float64(fs.Usage), 0)
+	return col.addSample(samples, "Filesystem.TimeToFull", subj, math.Floor(free/growth))
+}
+
+// forgetUsage drops the history of the filesystems that weren't seen during the cycle
+func (col *collector) forgetUsage() {
+	for key, h := range col.usage {
+		if !h.seen.Equal(col.now) {
+			delete(col.usage, key)
+		}
+	}
+}
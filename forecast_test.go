@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var forecastStart = time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// usageSeries is the stats of /dev/sda1 every step from forecastStart, with the given usages
+func usageSeries(step time.Duration, usages ...uint64) []*info.ContainerStats {
+	stats := make([]*info.ContainerStats, len(usages))
+	for i, usage := range usages {
+		stats[i] = &info.ContainerStats{
+			Timestamp:  forecastStart.Add(time.Duration(i) * step),
+			Filesystem: []info.FsStats{{Device: "/dev/sda1", Usage: usage, Limit: 10000}},
+		}
+	}
+	return stats
+}
+
+// linearUsage is n usages starting at 5000, growing by perStep each step
+func linearUsage(n int, perStep int) []uint64 {
+	usages := make([]uint64, n)
+	for i := range usages {
+		usages[i] = uint64(5000 + i*perStep)
+	}
+	return usages
+}
+
+func TestUsageHistoryGrowth(t *testing.T) {
+	defer func(window time.Duration) { *forecastWindow = window }(*forecastWindow)
+	*forecastWindow = time.Hour
+
+	tests := []struct {
+		desc   string
+		step   time.Duration
+		usages []uint64
+		growth float64
+		ok     bool
+	}{
+		{"growing", 5 * time.Minute, linearUsage(7, 600), 2, true},
+		{"flat", 5 * time.Minute, linearUsage(7, 0), 0, true},
+		{"shrinking", 5 * time.Minute, linearUsage(7, -300), -1, true},
+		{"noisy growth", 5 * time.Minute, []uint64{5000, 5700, 6100, 6900, 7300}, 1.9333, true},
+		{"too few points", 15 * time.Minute, linearUsage(2, 600), 0, false},
+		{"shorter than a quarter of the window", time.Minute, linearUsage(14, 600), 0, false},
+		{"a quarter of the window", time.Minute, linearUsage(16, 600), 10, true},
+	}
+	for _, test := range tests {
+		stats := usageSeries(test.step, test.usages...)
+		h := &usageHistory{}
+		h.record(stats, "/dev/sda1", stats[len(stats)-1].Timestamp)
+		growth, ok := h.growth()
+		if ok != test.ok || math.Abs(growth-test.growth) > 1e-3 {
+			t.Errorf("%s: growth = %g, %v, want %g, %v", test.desc, growth, ok, test.growth, test.ok)
+		}
+	}
+}
+
+func TestUsageHistoryRecord(t *testing.T) {
+	defer func(window time.Duration) { *forecastWindow = window }(*forecastWindow)
+	*forecastWindow = 30 * time.Minute
+
+	stats := usageSeries(10*time.Minute, linearUsage(6, 100)...)
+	h := &usageHistory{}
+	// The stats windows of consecutive cycles overlap
+	h.record(stats[:4], "/dev/sda1", stats[3].Timestamp)
+	h.record(stats[2:], "/dev/sda1", stats[5].Timestamp)
+	h.record(stats[2:], "/dev/sda1", stats[5].Timestamp)
+
+	// Points older than the window are forgotten
+	if len(h.points) != 4 || !h.points[0].time.Equal(stats[2].Timestamp) {
+		t.Fatalf("recorded %d points from %s, want 4 from %s", len(h.points), h.points[0].time, stats[2].Timestamp)
+	}
+	for i := 1; i < len(h.points); i++ {
+		if !h.points[i].time.After(h.points[i-1].time) {
+			t.Errorf("point %d at %s isn't after point %d at %s", i, h.points[i].time, i-1, h.points[i-1].time)
+		}
+	}
+
+	h.record(usageSeries(time.Minute, 1), "/dev/sdb1", stats[5].Timestamp)
+	if len(h.points) != 4 {
+		t.Errorf("recorded %d points, the stats of another device added some", len(h.points))
+	}
+}
+
+func TestAddTimeToFull(t *testing.T) {
+	defer func(window time.Duration) { *forecastWindow = window }(*forecastWindow)
+	*forecastWindow = time.Hour
+
+	names, err := newServiceNames("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		desc   string
+		usages []uint64
+		want   interface{}
+	}{
+		// 2000 bytes free at 2 bytes per second
+		{"growing", linearUsage(6, 600), 1000.0},
+		{"flat", linearUsage(6, 0), nil},
+		{"shrinking", linearUsage(6, -300), nil},
+	}
+	for _, test := range tests {
+		col := newCollector(nil, endpoint{host: "node1"}, 20, &thresholdRules{defaults: make(thresholds)}, names, nil)
+		stats := usageSeries(5*time.Minute, test.usages...)
+		col.now = stats[len(stats)-1].Timestamp
+		fs := &stats[len(stats)-1].Filesystem[0]
+
+		samples := col.addTimeToFull(nil, subject{device: "/dev/sda1"}, stats, fs)
+		var got interface{}
+		if len(samples) > 0 {
+			got = samples[0].Metric
+		}
+		if got != test.want {
+			t.Errorf("%s: Filesystem.TimeToFull = %v, want %v", test.desc, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+)
+
+var k8sSkipPause = flag.Bool("k8s_skip_pause", true, "specify whether to skip the pause (infra) containers of kubernetes pods (default true)")
+
+// k8sPodContainer is a container of a kubernetes pod, as named by the kubelet:
+// k8s_<container>_<pod>_<namespace>_<uid>_<attempt>
+type k8sPodContainer struct {
+	container string
+	pod       string
+	namespace string
+	uid       string
+	attempt   int
+}
+
+// parseK8sName splits the docker name of a container run by the kubelet, ok being false
+// when name doesn't follow its convention
+func parseK8sName(name string) (k8s *k8sPodContainer, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(name, "/"), "_")
+	if len(parts) != 6 || parts[0] != "k8s" {
+		return nil, false
+	}
+	for _, part := range parts[1:5] {
+		if part == "" {
+			return nil, false
+		}
+	}
+	attempt, err := strconv.Atoi(parts[5])
+	if err != nil {
+		return nil, false
+	}
+	return &k8sPodContainer{
+		// Older kubelets append a hash of the container spec: <container>.<hash>
+		container: strings.SplitN(parts[1], ".", 2)[0],
+		pod:       parts[2],
+		namespace: parts[3],
+		uid:       parts[4],
+		attempt:   attempt,
+	}, true
+}
+
+// pause tells whether this is the infra container holding the namespaces of the pod
+func (k8s *k8sPodContainer) pause() bool {
+	return k8s.container == "POD"
+}
+
+// label names the container after its pod, leaving out the restart attempt so that
+// services don't change when the container restarts
+func (k8s *k8sPodContainer) label() string {
+	return k8s.namespace + "/" + k8s.pod + "/" + k8s.container
+}
+
+// restartOf tells whether k8s is the container prev once restarted: the kubelet restarts a container
+// of a pod as a new docker container, with a higher attempt
+func (k8s *k8sPodContainer) restartOf(prev *k8sPodContainer) bool {
+	return prev != nil && k8s.label() == prev.label() && k8s.uid == prev.uid && k8s.attempt > prev.attempt
+}
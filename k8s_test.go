@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseK8sName(t *testing.T) {
+	tests := []struct {
+		name string
+		want *k8sPodContainer
+	}{
+		{"k8s_api_mypod-1234_default_uid-5678_3", &k8sPodContainer{"api", "mypod-1234", "default", "uid-5678", 3}},
+		{"/k8s_api_mypod-1234_default_uid-5678_0", &k8sPodContainer{"api", "mypod-1234", "default", "uid-5678", 0}},
+		{"k8s_api.1a2b3c_mypod_kube-system_uid_1", &k8sPodContainer{"api", "mypod", "kube-system", "uid", 1}},
+		{"k8s_POD_mypod_default_uid_0", &k8sPodContainer{"POD", "mypod", "default", "uid", 0}},
+		{"web", nil},
+		{"k8s_api_mypod_default_uid", nil},
+		{"k8s_api_mypod_default_uid_x", nil},
+		{"k8s__mypod_default_uid_0", nil},
+		{"k8z_api_mypod_default_uid_0", nil},
+	}
+	for _, test := range tests {
+		got, ok := parseK8sName(test.name)
+		if ok != (test.want != nil) {
+			t.Errorf("parseK8sName(%q) ok = %v, want %v", test.name, ok, test.want != nil)
+			continue
+		}
+		if ok && *got != *test.want {
+			t.Errorf("parseK8sName(%q) = %+v, want %+v", test.name, *got, *test.want)
+		}
+	}
+}
+
+func TestK8sRestartOf(t *testing.T) {
+	prev, _ := parseK8sName("k8s_api_mypod_default_uid_3")
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"k8s_api_mypod_default_uid_4", true},
+		{"k8s_api_mypod_default_uid_3", false},
+		{"k8s_api_mypod_default_uid_2", false},
+		{"k8s_api_otherpod_default_uid_4", false},
+		{"k8s_api_mypod_default_otheruid_4", false},
+		{"k8s_db_mypod_default_uid_4", false},
+	}
+	for _, test := range tests {
+		k8s, _ := parseK8sName(test.name)
+		if got := k8s.restartOf(prev); got != test.want {
+			t.Errorf("%s restartOf %s = %v, want %v", test.name, prev.label(), got, test.want)
+		}
+	}
+	if k8s, _ := parseK8sName("k8s_api_mypod_default_uid_4"); k8s.restartOf(nil) {
+		t.Errorf("restartOf(nil) = true, want false")
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var containerGoneState = flag.String("container_gone_state", "expired", "specify the state of the final event sent for each service of a container that went away (default expired)")
+
+// containerRecord is what the collector remembers about a container from one cycle to the next
+type containerRecord struct {
+	subject subject
+	// Latest sample of each service of the container
+	services map[string]Sample
+}
+
+// restarted tells whether the container restarted since prev, its cumulative CPU usage having gone backwards
+func restarted(prev *info.ContainerStats, stats []*info.ContainerStats) bool {
+	if prev == nil {
+		return false
+	}
+	usage := prev.Cpu.Usage.Total
+	for _, s := range stats {
+		if !s.Timestamp.After(prev.Timestamp) {
+			continue
+		}
+		if s.Cpu.Usage.Total < usage {
+			return true
+		}
+		usage = s.Cpu.Usage.Total
+	}
+	return false
+}
+
+// oneOff tells whether a metric is only sent when something happens, lifecycle events
+// and counter resets, so that it doesn't expire along with the container
+func oneOff(name string) bool {
+	return strings.HasPrefix(name, "Container.") || name == "Counters.Reset"
+}
+
+// addRestarted reports that a container restarted
+func (col *collector) addRestarted(samples []Sample, subj subject) []Sample {
+	glog.Infof("container %s restarted", subj.label())
+	samples = col.addSample(samples, "Container.Restarted", subj, 1)
+	samples[len(samples)-1].Description = fmt.Sprintf("container %s restarted", subj.container)
+	return samples
+}
+
+// addLifecycle compares the containers of the cycle with the ones of the previous cycle: containers
+// that appeared are reported, and so are the ones that went away, along with a final event for each
+// of their services so that they don't just silently expire in Riemann. A kubernetes container replaced
+// by the next attempt of the same pod container is reported as restarted instead.
+// Nothing is reported on the first cycle, there being nothing to compare with.
+func (col *collector) addLifecycle(samples []Sample, subjects map[string]subject) []Sample {
+	containers := make(map[string]*containerRecord, len(subjects))
+	for name, subj := range subjects {
+		containers[name] = &containerRecord{subject: subj, services: make(map[string]Sample)}
+	}
+	emitted := make(map[string]bool, len(samples))
+	for _, sample := range samples {
+		emitted[sample.Service] = true
+		if oneOff(sample.Name) {
+			continue
+		}
+		if record, found := containers[sample.Container]; found {
+			record.services[sample.Service] = sample
+		}
+	}
+
+	// Containers without stats during the cycle keep the services they had
+	for name, record := range containers {
+		if prev, found := col.containers[name]; found && len(record.services) == 0 {
+			record.services = prev.services
+		}
+	}
+
+	if col.containers != nil {
+		var appeared, gone []string
+		for name := range containers {
+			if _, found := col.containers[name]; !found {
+				appeared = append(appeared, name)
+			}
+		}
+		for name := range col.containers {
+			if _, found := containers[name]; !found {
+				gone = append(gone, name)
+			}
+		}
+		sort.Strings(appeared)
+		sort.Strings(gone)
+
+		for _, name := range appeared {
+			record := containers[name]
+			if prev := col.restartedFrom(record, gone); prev != "" {
+				gone = removeString(gone, prev)
+				samples = col.addRestarted(samples, record.subject)
+				continue
+			}
+			glog.Infof("container %s appeared", record.subject.label())
+			samples = col.addSample(samples, "Container.Appeared", record.subject, 1)
+			samples[len(samples)-1].Description = fmt.Sprintf("container %s appeared", name)
+		}
+		for _, name := range gone {
+			record := col.containers[name]
+			glog.Infof("container %s is gone", record.subject.label())
+			samples = col.addGone(samples, name, record, emitted)
+		}
+	}
+
+	col.containers = containers
+	return samples
+}
+
+// restartedFrom returns which of the gone containers record is the restart of, empty if none
+func (col *collector) restartedFrom(record *containerRecord, gone []string) string {
+	if record.subject.k8s == nil {
+		return ""
+	}
+	for _, name := range gone {
+		if record.subject.k8s.restartOf(col.containers[name].subject.k8s) {
+			return name
+		}
+	}
+	return ""
+}
+
+func removeString(items []string, item string) []string {
+	for i := range items {
+		if items[i] == item {
+			return append(items[:i:i], items[i+1:]...)
+		}
+	}
+	return items
+}
+
+// addGone reports that a container went away, and sends the final event of each of its services
+// that wasn't sent during the cycle already
+func (col *collector) addGone(samples []Sample, name string, record *containerRecord, emitted map[string]bool) []Sample {
+	samples = col.addSample(samples, "Container.Gone", record.subject, 1)
+	gone := &samples[len(samples)-1]
+	gone.State = "critical"
+	gone.Description = fmt.Sprintf("container %s is gone", name)
+
+	for service, sample := range record.services {
+		if emitted[service] {
+			continue
+		}
+		if sample.State != "" && sample.State != *containerGoneState {
+			sample.Previous = sample.State
+		} else {
+			sample.Previous = ""
+		}
+		sample.State = *containerGoneState
+		sample.Description = fmt.Sprintf("container %s is gone", name)
+		sample.Time = col.now.Unix()
+		samples = append(samples, sample)
+	}
+	return samples
+}
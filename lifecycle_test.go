@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/client"
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var lifecycleStart = time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// testContainer is a container with two stats during cycle, its CPU usage and network counters at cpu and net
+func testContainer(name, alias string, cycle int, cpu, net uint64) info.ContainerInfo {
+	container := info.ContainerInfo{ContainerReference: info.ContainerReference{Name: name, Aliases: []string{alias}}}
+	end := lifecycleStart.Add(time.Duration(cycle) * 10 * time.Second)
+	for _, at := range []time.Time{end.Add(-5 * time.Second), end} {
+		stats := &info.ContainerStats{Timestamp: at}
+		stats.Cpu.Usage.Total = cpu
+		stats.Network.RxBytes = net
+		container.Stats = append(container.Stats, stats)
+	}
+	return container
+}
+
+// withoutStats is a container that cadvisor returns without stats, as right after it started
+func withoutStats(name, alias string) info.ContainerInfo {
+	return info.ContainerInfo{ContainerReference: info.ContainerReference{Name: name, Aliases: []string{alias}}}
+}
+
+// collectCycles runs a collector over cycles of containers, returning the samples of each cycle
+func collectCycles(t *testing.T, cycles [][]info.ContainerInfo) [][]Sample {
+	cycle := 0
+	server := fakeCadvisor(func() []info.ContainerInfo { return cycles[cycle] }, info.ContainerInfo{ContainerReference: info.ContainerReference{Name: "/"}})
+	defer server.Close()
+
+	c, err := client.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := newServiceNames("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := newCollector(c, endpoint{host: "node1", address: server.URL}, 20, &thresholdRules{defaults: make(thresholds)}, names, nil)
+
+	var batches [][]Sample
+	for cycle = range cycles {
+		samples, err := col.collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		batches = append(batches, samples)
+	}
+	return batches
+}
+
+// lifecycleEvents lists the lifecycle events of a cycle, and the containers with expired services
+func lifecycleEvents(samples []Sample) (events []string, expired []string) {
+	gone := make(map[string]bool)
+	for _, sample := range samples {
+		switch {
+		case sample.Name == "Container.Appeared" || sample.Name == "Container.Gone" || sample.Name == "Container.Restarted":
+			events = append(events, fmt.Sprintf("%s %s", sample.Name, sample.Container))
+		case sample.State == "expired" && !gone[sample.Container]:
+			gone[sample.Container] = true
+			expired = append(expired, sample.Container)
+		}
+	}
+	sort.Strings(events)
+	sort.Strings(expired)
+	return events, expired
+}
+
+func TestLifecycle(t *testing.T) {
+	tests := []struct {
+		desc    string
+		cycles  [][]info.ContainerInfo
+		events  []string
+		expired []string
+	}{
+		{
+			"appeared",
+			[][]info.ContainerInfo{
+				{testContainer("/docker/a", "web", 0, 1e9, 100)},
+				{testContainer("/docker/a", "web", 1, 2e9, 200), testContainer("/docker/b", "db", 1, 1e9, 100)},
+			},
+			[]string{"Container.Appeared /docker/b"},
+			nil,
+		},
+		{
+			"gone",
+			[][]info.ContainerInfo{
+				{testContainer("/docker/a", "web", 0, 1e9, 100), testContainer("/docker/b", "db", 0, 1e9, 100)},
+				{testContainer("/docker/a", "web", 1, 2e9, 200)},
+			},
+			[]string{"Container.Gone /docker/b"},
+			[]string{"/docker/b"},
+		},
+		{
+			"kept without stats",
+			[][]info.ContainerInfo{
+				{testContainer("/docker/a", "web", 0, 1e9, 100)},
+				{withoutStats("/docker/a", "web")},
+			},
+			nil,
+			nil,
+		},
+		{
+			"back with stats",
+			[][]info.ContainerInfo{
+				{testContainer("/docker/a", "web", 0, 1e9, 100)},
+				{withoutStats("/docker/a", "web")},
+				{testContainer("/docker/a", "web", 2, 2e9, 200)},
+			},
+			nil,
+			nil,
+		},
+		{
+			"gone after a cycle without stats",
+			[][]info.ContainerInfo{
+				{testContainer("/docker/a", "web", 0, 1e9, 100)},
+				{withoutStats("/docker/a", "web")},
+				nil,
+			},
+			[]string{"Container.Gone /docker/a"},
+			[]string{"/docker/a"},
+		},
+		{
+			"docker restart",
+			[][]info.ContainerInfo{
+				{testContainer("/docker/a", "web", 0, 5e9, 100)},
+				{testContainer("/docker/a", "web", 1, 1e9, 200)},
+			},
+			[]string{"Container.Restarted /docker/a"},
+			nil,
+		},
+		{
+			"kubernetes attempt bump",
+			[][]info.ContainerInfo{
+				{testContainer("/docker/a", "k8s_api_mypod_default_uid_3", 0, 5e9, 100)},
+				{testContainer("/docker/b", "k8s_api_mypod_default_uid_4", 1, 1e9, 100)},
+			},
+			[]string{"Container.Restarted /docker/b"},
+			nil,
+		},
+		{
+			"alias taken over",
+			[][]info.ContainerInfo{
+				{testContainer("/docker/a", "web", 0, 5e9, 100)},
+				{testContainer("/docker/b", "web", 1, 1e9, 100)},
+			},
+			[]string{"Container.Appeared /docker/b", "Container.Gone /docker/a"},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		batches := collectCycles(t, test.cycles)
+		for i, batch := range batches[:len(batches)-1] {
+			if events, expired := lifecycleEvents(batch); events != nil || expired != nil {
+				t.Errorf("%s: cycle %d got events %v and expired %v, want none", test.desc, i, events, expired)
+			}
+		}
+		events, expired := lifecycleEvents(batches[len(batches)-1])
+		if !reflect.DeepEqual(events, test.events) || !reflect.DeepEqual(expired, test.expired) {
+			t.Errorf("%s: got events %v and expired %v, want %v and %v", test.desc, events, expired, test.events, test.expired)
+		}
+	}
+}
+
+func TestLifecycleGoneServices(t *testing.T) {
+	batches := collectCycles(t, [][]info.ContainerInfo{
+		{testContainer("/docker/a", "web", 0, 1e9, 500)},
+		// The network counters went backwards, Counters.Reset is sent
+		{testContainer("/docker/a", "web", 1, 2e9, 100)},
+		nil,
+	})
+
+	reset := false
+	for _, sample := range batches[1] {
+		reset = reset || sample.Name == "Counters.Reset"
+	}
+	if !reset {
+		t.Fatalf("no Counters.Reset on the cycle the network counters went backwards")
+	}
+
+	services := make(map[string]bool)
+	for _, sample := range batches[1] {
+		if sample.Container == "/docker/a" && sample.Name != "Counters.Reset" && !strings.HasPrefix(sample.Name, "Container.") {
+			services[sample.Service] = true
+		}
+	}
+	expired := make(map[string]bool)
+	for _, sample := range batches[2] {
+		if sample.State != "expired" {
+			continue
+		}
+		if sample.Name == "Counters.Reset" {
+			t.Errorf("one-off %s sent as expired", sample.Service)
+		}
+		if sample.Description != "container /docker/a is gone" {
+			t.Errorf("expired %s described as %q", sample.Service, sample.Description)
+		}
+		expired[sample.Service] = true
+	}
+	if !reflect.DeepEqual(expired, services) {
+		t.Errorf("expired services %v, want the services of the previous cycle %v", expired, services)
+	}
+}
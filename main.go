@@ -2,144 +2,148 @@ package main
 
 import (
 	"flag"
-	"fmt"
-	"time"
+	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/bigdatadev/goryman"
 	"github.com/golang/glog"
-	"github.com/google/cadvisor/client"
 	info "github.com/google/cadvisor/info/v1"
 )
 
 var riemannAddress = flag.String("riemann_address", "localhost:5555", "specify the riemann server location")
-var cadvisorAddress = flag.String("cadvisor_address", "http://localhost:8080", "specify the cadvisor API server location")
+var cadvisorAddress = flag.String("cadvisor_address", "http://localhost:8080", "specify the cadvisor API server location, or a comma separated list of [host=]location to poll several")
 var sampleInterval = flag.Duration("interval", 10*time.Second, "Interval between sampling (default: 10s)")
 var hostEventRiemann = flag.String("riemann_host_event", "", "specify host in riemann event (default '')")
 var ttlEventRiemann = flag.Int("riemann_ttl_event", 20, "specify host in riemann event in seconds (default 20)")
 var thresholdWarning = flag.Int("threshold_warning", 80, "specify threshold of warning (default 80)")
 var thresholdCritical = flag.Int("threshold_critical", 95, "specify threshold of critical (default 95)")
 
-func pushToRiemann(r *goryman.GorymanClient, host string, service string, metric interface{}, ttl float32, tags []string, state string) {
-	err := r.SendEvent(&goryman.Event{
-		Host:    host,
-		Service: service,
-		Metric:  metric,
-		Ttl:     ttl,
-		Tags:    tags,
-		State:   state,
-	})
-	if err != nil {
-		glog.Fatalf("unable to write to riemann: %s", err)
-	}
-}
-
 func main() {
 	defer glog.Flush()
 	flag.Parse()
 
+	// Settings of the configuration file, then the threshold rules and service names
+	cfg := &config{rules: &thresholdRules{defaults: make(thresholds)}}
+	if *configFile != "" {
+		var err error
+		if cfg, err = loadConfig(*configFile); err != nil {
+			glog.Fatalf("unable to load configuration: %s", err)
+		}
+	}
+	rules := cfg.rules
+	for name, rule := range defaultThresholds() {
+		if err := rule.validate(); err != nil {
+			glog.Fatalf("invalid threshold of %s: %s", name, err)
+		}
+		if _, found := rules.defaults[name]; !found {
+			rules.defaults[name] = rule
+		}
+	}
+	names, err := newServiceNames(*serviceTemplate, cfg.services)
+	if err != nil {
+		glog.Fatalf("unable to load configuration: %s", err)
+	}
+
+	if *counterResetPolicy != "skip" && *counterResetPolicy != "rebase" {
+		glog.Fatalf("invalid counter_reset %q, expected skip or rebase", *counterResetPolicy)
+	}
+
 	// Setting up the Riemann client
 	r := goryman.NewGorymanClient(*riemannAddress)
-	err := r.Connect()
-	if err != nil {
-		glog.Fatalf("unable to connect to riemann: %s", err)
+	r.SetMaxMessageSize(*maxMessageRiemann)
+	if *tlsRiemann {
+		err := r.SetTLS(&goryman.TLSOptions{
+			CAFile:             *tlsCARiemann,
+			CertFile:           *tlsCertRiemann,
+			KeyFile:            *tlsKeyRiemann,
+			ServerName:         *tlsServerNameRiemann,
+			InsecureSkipVerify: *tlsSkipVerifyRiemann,
+		})
+		if err != nil {
+			glog.Fatalf("unable to setup riemann TLS: %s", err)
+		}
+	}
+	// UDP writes succeed even when nothing listens, the spool needs to know what Riemann got
+	if *spoolDir != "" || !*udpRiemann {
+		r.SetAcknowledged(true)
+	}
+	if err = r.SetReconnect(*reconnectMinRiemann, *reconnectMaxRiemann); err != nil {
+		glog.Fatalf("invalid riemann_reconnect_min or riemann_reconnect_max: %s", err)
+	}
+	r.OnStateChange(func(state goryman.ConnState, err error) {
+		if err != nil {
+			glog.Errorf("riemann %s: %s", state, err)
+			return
+		}
+		glog.Infof("riemann %s", state)
+	})
+	// Keep collecting while riemann is down, the client redials in the background
+	if err = r.Connect(); err != nil {
+		glog.Errorf("unable to connect to riemann: %s", err)
+	}
+
+	// Setting up the spool
+	var sp *spool
+	if *spoolDir != "" {
+		if sp, err = newSpool(*spoolDir, *spoolMaxSize, *spoolMaxAge); err != nil {
+			glog.Fatalf("unable to open spool: %s", err)
+		}
 	}
-	//defer r.Close()
 
-	// Setting up the cadvisor client
-	c, err := client.NewClient(*cadvisorAddress)
+	// Setting up the sinks, each one running on its own
+	sinkList := []Sink{
+		newAsyncSink("riemann", newRiemannSink(r, *sendStatesRiemann, sp, *hostEventRiemann, float32(*ttlEventRiemann), *sampleInterval), *sinkQueueSize),
+	}
+	if *prometheusAddress != "" {
+		p := newPrometheusSink()
+		http.Handle("/metrics", p)
+		go func() {
+			glog.Fatal(http.ListenAndServe(*prometheusAddress, nil))
+		}()
+		sinkList = append(sinkList, newAsyncSink("prometheus", p, *sinkQueueSize))
+	}
+	sinks := newFanoutSink(sinkList...)
+
+	// Setting up a poller for each cadvisor
+	endpoints, err := parseEndpoints(*cadvisorAddress, *hostEventRiemann)
 	if err != nil {
-		glog.Fatalf("unable to setup cadvisor client: %s", err)
-	}
-
-	ttl := float32(*ttlEventRiemann)
-
-    stateEmpty := ""
-
-	// Setting up the ticker
-	ticker := time.NewTicker(*sampleInterval).C
-	for {
-		select {
-		case <-ticker:
-			// Make the call to get all the possible data points
-			request := info.ContainerInfoRequest{
-                        	NumStats: 10,
-			}
-			returned, err := c.AllDockerContainers(&request)
-			if err != nil {
-				glog.Fatalf("unable to retrieve machine data: %s", err)
-			}
-
-			machineInfo, err := c.MachineInfo()
-			if err != nil {
-				glog.Fatal("unable to getMachineInfo: %s", err)
-			}
-
-			// Start dumping data into riemann
-			// Loop into each ContainerInfo
-			// Get stats
-			// Push into riemann
-			for _, container := range returned {
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Cpu.Load %s", container.Aliases[0]), int(container.Stats[0].Cpu.LoadAverage), ttl, container.Aliases, stateEmpty)
-
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Cpu.Usage.Total %s", container.Aliases[0]), int(container.Stats[0].Cpu.Usage.Total), ttl, container.Aliases, stateEmpty)
-
-                cpuUsagePercent := getCpuTotalPercent(&container.Spec, container.Stats, machineInfo)
-                stateCpu := computeStatePercent(cpuUsagePercent)
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Cpu.Usage.TotalPercent %s", container.Aliases[0]), cpuUsagePercent, ttl, container.Aliases, stateCpu)
-
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Cpu.Usage.User %s", container.Aliases[0]), int(container.Stats[0].Cpu.Usage.User), ttl, container.Aliases, stateEmpty)
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Cpu.Usage.System %s", container.Aliases[0]), int(container.Stats[0].Cpu.Usage.System), ttl, container.Aliases, stateEmpty)
-
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Memory.UsageMB %s", container.Aliases[0]), getMemoryUsage(container.Stats), ttl, container.Aliases, stateEmpty)
-
-                memoryUsagePercent := getMemoryUsagePercent(&container.Spec, container.Stats, machineInfo)
-                stateMemory := computeStatePercent(float64(memoryUsagePercent))
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Memory.UsagePercent %s", container.Aliases[0]), memoryUsagePercent, ttl, container.Aliases, stateMemory)
-				
-                pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Memory.UsageHotPercent %s", container.Aliases[0]), getHotMemoryPercent(&container.Spec, container.Stats, machineInfo), ttl, container.Aliases, stateEmpty)
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Memory.UsageColdPercent %s", container.Aliases[0]), getColdMemoryPercent(&container.Spec, container.Stats, machineInfo), ttl, container.Aliases, stateEmpty)
-
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Network.RxBytes %s", container.Aliases[0]), int(container.Stats[0].Network.RxBytes), ttl, container.Aliases, stateEmpty)
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Network.RxPackets %s", container.Aliases[0]), int(container.Stats[0].Network.RxPackets), ttl, container.Aliases, stateEmpty)
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Network.RxErrors %s", container.Aliases[0]), int(container.Stats[0].Network.RxErrors), ttl, container.Aliases, stateEmpty)
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Network.RxDropped %s", container.Aliases[0]), int(container.Stats[0].Network.RxDropped), ttl, container.Aliases, stateEmpty)
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Network.TxBytes %s", container.Aliases[0]), int(container.Stats[0].Network.TxBytes), ttl, container.Aliases, stateEmpty)
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Network.TxPackets %s", container.Aliases[0]), int(container.Stats[0].Network.TxPackets), ttl, container.Aliases, stateEmpty)
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Network.TxErrors %s", container.Aliases[0]), int(container.Stats[0].Network.TxErrors), ttl, container.Aliases, stateEmpty)
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Network.TxDropped %s", container.Aliases[0]), int(container.Stats[0].Network.TxDropped), ttl, container.Aliases, stateEmpty)
-			}
-
-			returnedFS, err := c.ContainerInfo("/",nil)
-			if err != nil {
-				glog.Fatal("unable to ContainerInfo: %s", err)
-			}
-			containerStats := returnedFS.Stats[0]
-			for _, fs := range containerStats.Filesystem  {
-				fsUsagePercent := getFsUsagePercent(fs.Usage,fs.Limit)
-				stateFS := computeStatePercent(float64(fsUsagePercent))
-				tags := []string{fs.Device}
-				pushToRiemann(r, *hostEventRiemann, fmt.Sprintf("Filesystem.UsagePercent %s", fs.Device), fsUsagePercent, ttl, tags, stateFS)
-			}
-
-			
-			
-			
+		glog.Fatalf("unable to setup cadvisor clients: %s", err)
+	}
+	http.DefaultClient.Timeout = *cadvisorTimeout
+	pollers := make([]*poller, len(endpoints))
+	for i, e := range endpoints {
+		if pollers[i], err = newPoller(e, float32(*ttlEventRiemann), rules, names, cfg.attributes); err != nil {
+			glog.Fatalf("unable to setup cadvisor client: %s", err)
 		}
 	}
-}
 
-func getFsUsagePercent(usage uint64, limite uint64) float64 {
-	return roundFloat(float64(usage*100)/float64(limite), 2);
-}
+	// Polling each cadvisor on its own ticker
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, p := range pollers {
+		wg.Add(1)
+		go func(p *poller) {
+			defer wg.Done()
+			p.run(*sampleInterval, sinks, stop)
+		}(p)
+	}
 
+	// Until asked to stop, then let the cycles in progress end and the sinks drain their queues
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	glog.Infof("received %s, shutting down", <-signals)
+	close(stop)
+	wg.Wait()
+	sinks.Close()
+}
 
-func computeStatePercent(value float64) string {
-    switch {
-        case value > float64(*thresholdCritical): return "critical"
-        case value > float64(*thresholdWarning): return "warning"
-    }
-    return "ok"
+func getFsUsagePercent(usage uint64, limite uint64) float64 {
+	return roundFloat(float64(usage*100)/float64(limite), 2)
 }
 
 func roundFloat(x float64, prec int) float64 {
@@ -151,14 +155,19 @@ func roundFloat(x float64, prec int) float64 {
 func getCpuTotalPercent(spec *info.ContainerSpec, stats []*info.ContainerStats, machine *info.MachineInfo) float64 {
 
 	cpuUsage := float64(0)
-	if (spec.HasCpu && len(stats) >= 2) {
-		cur := stats[len(stats) - 1];
-		prev := stats[len(stats) - 2];
-		rawUsage := float64(cur.Cpu.Usage.Total - prev.Cpu.Usage.Total);
-		intervalInNs := float64(cur.Timestamp.Sub(prev.Timestamp).Nanoseconds());
+	if spec.HasCpu && len(stats) >= 2 {
+		cur := stats[len(stats)-1]
+		prev := stats[len(stats)-2]
+		delta, _, ok := counterDelta(prev.Cpu.Usage.Total, cur.Cpu.Usage.Total)
+		// Two stats with the same timestamp make no interval
+		if !ok || !cur.Timestamp.After(prev.Timestamp) {
+			return cpuUsage
+		}
+		rawUsage := float64(delta)
+		intervalInNs := float64(cur.Timestamp.Sub(prev.Timestamp).Nanoseconds())
 		// Convert to millicores and take the percentage
-		cpuUsage = roundFloat(((rawUsage / intervalInNs) / float64(machine.NumCores)) * float64(100), 2);
-		if (cpuUsage > float64(100)) {
+		cpuUsage = roundFloat(((rawUsage/intervalInNs)/float64(machine.NumCores))*float64(100), 2)
+		if cpuUsage > float64(100) {
 			cpuUsage = float64(100)
 		}
 	}
@@ -176,13 +185,25 @@ func getMemoryUsage(stats []*info.ContainerStats) float64 {
 	return toMegabytes((stats[len(stats)-1].Memory.Usage))
 }
 
-func toMemoryPercent(usage uint64, spec *info.ContainerSpec, machine *info.MachineInfo) int {
+// memoryLimit is the memory limit of a container, saturated to the machine size,
+// 0 for the cgroups without a memory controller
+func memoryLimit(spec *info.ContainerSpec, machine *info.MachineInfo) uint64 {
+	if !spec.HasMemory {
+		return 0
+	}
 	// Saturate limit to the machine size.
 	limit := uint64(spec.Memory.Limit)
 	if limit > uint64(machine.MemoryCapacity) {
 		limit = uint64(machine.MemoryCapacity)
 	}
+	return limit
+}
 
+func toMemoryPercent(usage uint64, spec *info.ContainerSpec, machine *info.MachineInfo) int {
+	limit := memoryLimit(spec, machine)
+	if limit == 0 {
+		return 0
+	}
 	return int((usage * 100) / limit)
 }
 
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+func TestMemoryPercent(t *testing.T) {
+	machine := &info.MachineInfo{MemoryCapacity: 1000}
+	stats := []*info.ContainerStats{{Memory: info.MemoryStats{Usage: 300, WorkingSet: 200}}}
+
+	tests := []struct {
+		desc      string
+		spec      info.ContainerSpec
+		limit     uint64
+		usage     int
+		hot, cold int
+	}{
+		{"limited", info.ContainerSpec{HasMemory: true, Memory: info.MemorySpec{Limit: 600}}, 600, 50, 33, 16},
+		{"saturated to the machine", info.ContainerSpec{HasMemory: true, Memory: info.MemorySpec{Limit: 1 << 62}}, 1000, 30, 20, 10},
+		{"cgroup without memory controller", info.ContainerSpec{}, 0, 0, 0, 0},
+		{"zero limit", info.ContainerSpec{HasMemory: true}, 0, 0, 0, 0},
+	}
+	for _, test := range tests {
+		if limit := memoryLimit(&test.spec, machine); limit != test.limit {
+			t.Errorf("%s: memoryLimit = %d, want %d", test.desc, limit, test.limit)
+		}
+		usage := getMemoryUsagePercent(&test.spec, stats, machine)
+		hot := getHotMemoryPercent(&test.spec, stats, machine)
+		cold := getColdMemoryPercent(&test.spec, stats, machine)
+		if usage != test.usage || hot != test.hot || cold != test.cold {
+			t.Errorf("%s: usage, hot, cold = %d%%, %d%%, %d%%, want %d%%, %d%%, %d%%",
+				test.desc, usage, hot, cold, test.usage, test.hot, test.cold)
+		}
+	}
+}
+
+func TestCpuTotalPercent(t *testing.T) {
+	at := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	machine := &info.MachineInfo{NumCores: 2}
+	stats := func(from, to time.Time, total uint64) []*info.ContainerStats {
+		prev, cur := &info.ContainerStats{Timestamp: from}, &info.ContainerStats{Timestamp: to}
+		cur.Cpu.Usage.Total = total
+		return []*info.ContainerStats{prev, cur}
+	}
+
+	tests := []struct {
+		desc    string
+		spec    info.ContainerSpec
+		stats   []*info.ContainerStats
+		percent float64
+	}{
+		{"one core of two", info.ContainerSpec{HasCpu: true}, stats(at, at.Add(time.Second), 1e9), 50},
+		{"capped", info.ContainerSpec{HasCpu: true}, stats(at, at.Add(time.Second), 3e9), 100},
+		{"same timestamp", info.ContainerSpec{HasCpu: true}, stats(at, at, 1e9), 0},
+		{"no cpu controller", info.ContainerSpec{}, stats(at, at.Add(time.Second), 1e9), 0},
+		{"single stat", info.ContainerSpec{HasCpu: true}, stats(at, at.Add(time.Second), 1e9)[1:], 0},
+	}
+	for _, test := range tests {
+		if percent := getCpuTotalPercent(&test.spec, test.stats, machine); percent != test.percent {
+			t.Errorf("%s: getCpuTotalPercent = %g, want %g", test.desc, percent, test.percent)
+		}
+	}
+}
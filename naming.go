@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/golang/glog"
+)
+
+var serviceTemplate = flag.String("service_template", "", "specify a text/template naming the Riemann services, e.g. '{{lower .Name}}' (default '', the metric name followed by the alias or device)")
+
+// serviceData is what service templates can use
+type serviceData struct {
+	Name      string // Metric name, e.g. Cpu.Usage.TotalPercent
+	Label     string // What the default naming appends to the metric name
+	Alias     string
+	Aliases   []string
+	Container string
+	Namespace string
+	Device    string
+	Host      string
+
+	// Set for the containers of kubernetes pods
+	Pod          string
+	PodNamespace string
+	PodContainer string
+	Attempt      string
+}
+
+var serviceFuncs = template.FuncMap{
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": func(s, old, new string) string { return strings.Replace(s, old, new, -1) },
+	"join":    strings.Join,
+}
+
+// serviceNames names the services of the samples, from the template of their metric if it has one,
+// the global template otherwise, or else as the metric name followed by the label of the subject
+type serviceNames struct {
+	global  *template.Template
+	metrics map[string]*template.Template
+}
+
+func newServiceNames(global string, metrics map[string]string) (*serviceNames, error) {
+	names := &serviceNames{metrics: make(map[string]*template.Template)}
+	var err error
+	if global != "" {
+		if names.global, err = parseServiceTemplate("service_template", global); err != nil {
+			return nil, err
+		}
+	}
+	for name, text := range metrics {
+		if names.metrics[name], err = parseServiceTemplate(name, text); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// serviceTrialData is a representative subject that templates are tried out on, every field being set
+var serviceTrialData = serviceData{
+	Name:         "Cpu.Usage.TotalPercent",
+	Label:        "default/mypod-1234/api /dev/sda1",
+	Alias:        "k8s_api_mypod-1234_default_uid-5678_0",
+	Aliases:      []string{"k8s_api_mypod-1234_default_uid-5678_0", "aaaaaa"},
+	Container:    "/docker/aaaaaa",
+	Namespace:    "docker",
+	Device:       "/dev/sda1",
+	Host:         "node1",
+	Pod:          "mypod-1234",
+	PodNamespace: "default",
+	PodContainer: "api",
+	Attempt:      "0",
+}
+
+// parseServiceTemplate parses a template and tries it out, so that a template
+// using a field that doesn't exist is caught at startup
+func parseServiceTemplate(name string, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(serviceFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service template of %s: %s", name, err)
+	}
+	if err = tmpl.Execute(new(bytes.Buffer), serviceTrialData); err != nil {
+		return nil, fmt.Errorf("invalid service template of %s: %s", name, err)
+	}
+	return tmpl, nil
+}
+
+// service names the service of a metric of subj on host
+func (n *serviceNames) service(name string, host string, subj subject) string {
+	label := subj.label()
+	tmpl, found := n.metrics[name]
+	if !found {
+		tmpl = n.global
+	}
+	if tmpl != nil {
+		data := serviceData{
+			Name:      name,
+			Label:     label,
+			Aliases:   subj.aliases,
+			Container: subj.container,
+			Namespace: subj.namespace,
+			Device:    subj.device,
+			Host:      host,
+		}
+		if len(subj.aliases) > 0 {
+			data.Alias = subj.aliases[0]
+		}
+		if subj.k8s != nil {
+			data.Pod = subj.k8s.pod
+			data.PodNamespace = subj.k8s.namespace
+			data.PodContainer = subj.k8s.container
+			data.Attempt = strconv.Itoa(subj.k8s.attempt)
+		}
+		b := new(bytes.Buffer)
+		err := tmpl.Execute(b, data)
+		if err == nil {
+			return b.String()
+		}
+		glog.Errorf("unable to name the service of %s %s: %s", name, label, err)
+	}
+
+	if label != "" {
+		return fmt.Sprintf("%s %s", name, label)
+	}
+	return name
+}
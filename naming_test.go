@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseServiceTemplate(t *testing.T) {
+	tests := []struct {
+		text  string
+		valid bool
+	}{
+		{"{{lower .Name}}", true},
+		{"{{index .Aliases 0}}.{{.Name}}", true},
+		{"{{.Name}} {{join .Aliases \",\"}}", true},
+		{"{{.PodNamespace}}.{{.Pod}}.{{.PodContainer}}.{{.Name}}", true},
+		{"{{replace .Device \"/\" \"_\"}}", true},
+		{"{{.Nope}}", false},
+		{"{{.Name", false},
+		{"{{nope .Name}}", false},
+		{"{{index .Aliases 5}}", false},
+	}
+	for _, test := range tests {
+		_, err := parseServiceTemplate("service_template", test.text)
+		if (err == nil) != test.valid {
+			t.Errorf("parseServiceTemplate(%q) = %v, want valid %v", test.text, err, test.valid)
+		}
+	}
+}
+
+func TestServiceNames(t *testing.T) {
+	names, err := newServiceNames("{{lower .Name}} {{.Label}}", map[string]string{
+		"Memory.UsagePercent": "{{index .Aliases 0}}.memory.percent",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := subject{container: "/docker/aaaaaa", aliases: []string{"web", "aaaaaa"}}
+	pod, _ := parseK8sName("k8s_api_mypod-1234_default_uid-5678_3")
+
+	tests := []struct {
+		name    string
+		subj    subject
+		service string
+	}{
+		{"Cpu.Usage.TotalPercent", web, "cpu.usage.totalpercent web"},
+		{"Memory.UsagePercent", web, "web.memory.percent"},
+		{"Cpu.Usage.TotalPercent", subject{container: "/docker/bbbbbb", k8s: pod}, "cpu.usage.totalpercent default/mypod-1234/api"},
+		// The template fails without aliases, the default naming is used
+		{"Memory.UsagePercent", subject{container: "/system.slice/sshd.service"}, "Memory.UsagePercent /system.slice/sshd.service"},
+	}
+	for _, test := range tests {
+		if service := names.service(test.name, "node1", test.subj); service != test.service {
+			t.Errorf("service of %s = %q, want %q", test.name, service, test.service)
+		}
+	}
+}
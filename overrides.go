@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// pattern matches strings with a glob, or with a regular expression when enclosed in slashes
+type pattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func compilePattern(expr string) (*pattern, error) {
+	if len(expr) >= 2 && strings.HasPrefix(expr, "/") && strings.HasSuffix(expr, "/") {
+		re, err := regexp.Compile(expr[1 : len(expr)-1])
+		if err != nil {
+			return nil, err
+		}
+		return &pattern{re: re}, nil
+	}
+	if _, err := path.Match(expr, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %s", expr, err)
+	}
+	return &pattern{glob: expr}, nil
+}
+
+func (p *pattern) UnmarshalJSON(data []byte) error {
+	var expr string
+	if err := json.Unmarshal(data, &expr); err != nil {
+		return err
+	}
+	compiled, err := compilePattern(expr)
+	if err != nil {
+		return err
+	}
+	*p = *compiled
+	return nil
+}
+
+func (p *pattern) match(s string) bool {
+	if p.re != nil {
+		return p.re.MatchString(s)
+	}
+	matched, _ := path.Match(p.glob, s)
+	return matched
+}
+
+// ThresholdOverride replaces the threshold rules of some metrics for the containers
+// matching all of its patterns. The alias pattern matches if any alias matches.
+type ThresholdOverride struct {
+	Name       *pattern   `json:"name,omitempty"`
+	Alias      *pattern   `json:"alias,omitempty"`
+	Namespace  *pattern   `json:"namespace,omitempty"`
+	Thresholds thresholds `json:"thresholds"`
+}
+
+func (o *ThresholdOverride) validate() error {
+	if o.Name == nil && o.Alias == nil && o.Namespace == nil {
+		return fmt.Errorf("at least one of name, alias and namespace is required")
+	}
+	for name, rule := range o.Thresholds {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("invalid threshold of %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func (o *ThresholdOverride) matches(subj subject) bool {
+	if o.Name != nil && !o.Name.match(subj.container) {
+		return false
+	}
+	if o.Namespace != nil && !o.Namespace.match(subj.namespace) {
+		return false
+	}
+	if o.Alias != nil {
+		for _, alias := range subj.aliases {
+			if o.Alias.match(alias) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCompilePattern(t *testing.T) {
+	tests := []struct {
+		expr  string
+		s     string
+		match bool
+	}{
+		{"batch-*", "batch-nightly", true},
+		{"batch-*", "web", false},
+		{"batch-*", "mybatch-nightly", false},
+		{"/docker/*", "/docker/aaaaaa", true},
+		{"/docker/*", "/system.slice/sshd.service", false},
+		{"/^batch-[0-9]+$/", "batch-42", true},
+		{"/^batch-[0-9]+$/", "batch-x", false},
+		// Regular expressions aren't anchored
+		{"/batch/", "mybatch-nightly", true},
+		{"/", "/", true},
+		{"web", "web", true},
+	}
+	for _, test := range tests {
+		p, err := compilePattern(test.expr)
+		if err != nil {
+			t.Errorf("compilePattern(%q): %s", test.expr, err)
+			continue
+		}
+		if match := p.match(test.s); match != test.match {
+			t.Errorf("%q matching %q = %v, want %v", test.expr, test.s, match, test.match)
+		}
+	}
+
+	for _, expr := range []string{"batch-[", "/batch-[/"} {
+		if _, err := compilePattern(expr); err == nil {
+			t.Errorf("compilePattern(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestThresholdRulesRule(t *testing.T) {
+	var overrides []*ThresholdOverride
+	err := json.Unmarshal([]byte(`[
+		{"alias": "batch-*", "namespace": "docker", "thresholds": {"Cpu.Usage.TotalPercent": {"critical": 101}}},
+		{"name": "/^\\/docker\\//", "thresholds": {"Cpu.Usage.TotalPercent": {"critical": 99}, "Memory.UsagePercent": {"critical": 70}}},
+		{"alias": "/db/", "thresholds": {"Memory.UsagePercent": {"critical": 60}}}
+	]`), &overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := &thresholdRules{
+		defaults: thresholds{
+			"Cpu.Usage.TotalPercent": {Critical: level(95)},
+			"Memory.UsagePercent":    {Critical: level(95)},
+		},
+		overrides: overrides,
+	}
+
+	batch := subject{container: "/docker/aaaaaa", aliases: []string{"web-1", "batch-nightly"}, namespace: "docker"}
+	batchElsewhere := subject{container: "/system.slice/batch.service", aliases: []string{"batch-nightly"}}
+	db := subject{container: "/docker/bbbbbb", aliases: []string{"db"}, namespace: "docker"}
+	cgroupDb := subject{container: "/system.slice/db.service", aliases: []string{"db"}}
+	other := subject{container: "/system.slice/sshd.service"}
+
+	tests := []struct {
+		desc     string
+		name     string
+		subj     subject
+		critical interface{}
+	}{
+		// Any alias matches, along with the namespace
+		{"batch cpu", "Cpu.Usage.TotalPercent", batch, 101.0},
+		// The alias matches, not the namespace
+		{"batch elsewhere cpu", "Cpu.Usage.TotalPercent", batchElsewhere, 95.0},
+		// The first override matching has no rule of the metric, the second one does
+		{"batch memory", "Memory.UsagePercent", batch, 70.0},
+		// The first matching override wins
+		{"db memory", "Memory.UsagePercent", db, 70.0},
+		{"cgroup db memory", "Memory.UsagePercent", cgroupDb, 60.0},
+		{"db cpu", "Cpu.Usage.TotalPercent", db, 99.0},
+		{"other cpu", "Cpu.Usage.TotalPercent", other, 95.0},
+		{"no rule", "Network.RxBytes.Rate", batch, nil},
+	}
+	for _, test := range tests {
+		var critical interface{}
+		if rule := rules.rule(test.name, test.subj); rule != nil {
+			critical = *rule.Critical
+		}
+		if critical != test.critical {
+			t.Errorf("%s: critical level of %s = %v, want %v", test.desc, test.name, critical, test.critical)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var prometheusAddress = flag.String("prometheus_address", "", "specify the address to serve prometheus metrics on, e.g. :9101 (default '', disabled)")
+
+// prometheusSink keeps the samples of the latest cycle of each host and serves
+// them in the Prometheus text exposition format
+type prometheusSink struct {
+	mu      sync.RWMutex
+	samples map[string][]Sample
+}
+
+func newPrometheusSink() *prometheusSink {
+	return &prometheusSink{samples: make(map[string][]Sample)}
+}
+
+func (s *prometheusSink) Emit(samples []Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples[samples[0].Host] = samples
+	return nil
+}
+
+func (s *prometheusSink) Flush() error {
+	return nil
+}
+
+func (s *prometheusSink) Close() error {
+	return nil
+}
+
+func (s *prometheusSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	var samples []Sample
+	for _, hostSamples := range s.samples {
+		samples = append(samples, hostSamples...)
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(formatPrometheus(samples))
+}
+
+// formatPrometheus renders samples as gauges, grouped by metric name
+func formatPrometheus(samples []Sample) []byte {
+	families := make(map[string][]*Sample)
+	var names []string
+	for i := range samples {
+		if _, ok := prometheusValue(samples[i].Metric); !ok {
+			continue
+		}
+		name := prometheusName(samples[i].Name)
+		if _, found := families[name]; !found {
+			names = append(names, name)
+		}
+		families[name] = append(families[name], &samples[i])
+	}
+	sort.Strings(names)
+
+	b := new(bytes.Buffer)
+	for _, name := range names {
+		fmt.Fprintf(b, "# TYPE %s gauge\n", name)
+		for _, sample := range families[name] {
+			value, _ := prometheusValue(sample.Metric)
+			fmt.Fprintf(b, "%s{%s} %s\n", name, prometheusLabels(sample), value)
+		}
+	}
+	return b.Bytes()
+}
+
+// prometheusName turns a metric name such as Cpu.Usage.TotalPercent into cadvisor_cpu_usage_totalpercent
+func prometheusName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, name)
+	return "cadvisor_" + name
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func prometheusLabels(sample *Sample) string {
+	labels := []string{label("host", sample.Host)}
+	if sample.Container != "" {
+		labels = append(labels, label("container", sample.Container))
+	}
+	if len(sample.Aliases) > 0 {
+		labels = append(labels, label("alias", sample.Aliases[0]))
+		labels = append(labels, label("aliases", strings.Join(sample.Aliases, ",")))
+	}
+	if sample.Namespace != "" {
+		labels = append(labels, label("namespace", sample.Namespace))
+	}
+	if sample.Device != "" {
+		labels = append(labels, label("device", sample.Device))
+	}
+	return strings.Join(labels, ",")
+}
+
+func label(name string, value string) string {
+	return fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(value))
+}
+
+func prometheusValue(metric interface{}) (string, bool) {
+	switch v := metric.(type) {
+	case int:
+		return strconv.Itoa(v), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	}
+	return "", false
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFormatPrometheus(t *testing.T) {
+	samples := []Sample{
+		{Host: "node1", Name: "Machine.Cores", Metric: 4},
+		{Host: "node1", Name: "Cpu.Usage.TotalPercent", Metric: 12.5, Container: "/docker/aaaaaa", Aliases: []string{"web", "aaaaaa"}, Namespace: "docker"},
+		{Host: "node1", Name: "Filesystem.UsagePercent", Metric: float32(91.5), Container: "/docker/aaaaaa", Aliases: []string{"web", "aaaaaa"}, Namespace: "docker", Device: "/dev/sda1"},
+		{Host: "node1", Name: "Cpu.Usage.TotalPercent", Metric: 3.0, Container: "/system.slice/sshd.service"},
+		// Label values are escaped
+		{Host: "node1", Name: "Memory.UsageMB", Metric: 1.5, Container: "/docker/bbbbbb", Aliases: []string{`we"ird\name` + "\n"}},
+		// Non-numeric metrics are left out
+		{Host: "node1", Name: "Container.Appeared", Metric: "yes", Container: "/docker/bbbbbb"},
+		{Host: "node1", Name: "Cpu.Core.UsagePercent", Metric: math.NaN(), Container: "/docker/aaaaaa", Device: "cpu0"},
+		{Host: "node1", Name: "Filesystem.TimeToFull", Metric: math.Inf(1), Device: "/dev/sda1"},
+	}
+	want := `# TYPE cadvisor_cpu_core_usagepercent gauge
+cadvisor_cpu_core_usagepercent{host="node1",container="/docker/aaaaaa",device="cpu0"} NaN
+# TYPE cadvisor_cpu_usage_totalpercent gauge
+cadvisor_cpu_usage_totalpercent{host="node1",container="/docker/aaaaaa",alias="web",aliases="web,aaaaaa",namespace="docker"} 12.5
+cadvisor_cpu_usage_totalpercent{host="node1",container="/system.slice/sshd.service"} 3
+# TYPE cadvisor_filesystem_timetofull gauge
+cadvisor_filesystem_timetofull{host="node1",device="/dev/sda1"} +Inf
+# TYPE cadvisor_filesystem_usagepercent gauge
+cadvisor_filesystem_usagepercent{host="node1",container="/docker/aaaaaa",alias="web",aliases="web,aaaaaa",namespace="docker",device="/dev/sda1"} 91.5
+# TYPE cadvisor_machine_cores gauge
+cadvisor_machine_cores{host="node1"} 4
+# TYPE cadvisor_memory_usagemb gauge
+cadvisor_memory_usagemb{host="node1",container="/docker/bbbbbb",alias="we\"ird\\name\n",aliases="we\"ird\\name\n"} 1.5
+`
+	if got := string(formatPrometheus(samples)); got != want {
+		t.Errorf("formatPrometheus =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPrometheusName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Cpu.Usage.TotalPercent", "cadvisor_cpu_usage_totalpercent"},
+		{"Network.RxBytes.Rate", "cadvisor_network_rxbytes_rate"},
+		{"DiskIo.ServiceTimeMs", "cadvisor_diskio_servicetimems"},
+		{"Cpu.Core-Usage 2", "cadvisor_cpu_core_usage_2"},
+	}
+	for _, test := range tests {
+		if got := prometheusName(test.name); got != test.want {
+			t.Errorf("prometheusName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPrometheusSinkServesEachHost(t *testing.T) {
+	s := newPrometheusSink()
+	s.Emit([]Sample{{Host: "node1", Name: "Machine.Cores", Metric: 4}})
+	s.Emit([]Sample{{Host: "node2", Name: "Machine.Cores", Metric: 8}})
+	// The latest cycle of a host replaces the previous one
+	s.Emit([]Sample{{Host: "node1", Name: "Machine.Cores", Metric: 2}})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Body)
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 3 || lines[0] != "# TYPE cadvisor_machine_cores gauge" {
+		t.Fatalf("served\n%s\nwant a single family of 2 samples", body)
+	}
+	for _, want := range []string{`cadvisor_machine_cores{host="node1"} 2`, `cadvisor_machine_cores{host="node2"} 8`} {
+		if lines[1] != want && lines[2] != want {
+			t.Errorf("served\n%s\nwithout %s", body, want)
+		}
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4" {
+		t.Errorf("served as %q", ct)
+	}
+}
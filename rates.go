@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var counterResetPolicy = flag.String("counter_reset", "skip", "specify what to do with an interval during which a counter was reset: skip or rebase (default skip)")
+
+// containerCounter is a cumulative counter of the container stats
+type containerCounter struct {
+	name  string
+	value func(stats *info.ContainerStats) uint64
+}
+
+// fsCounter is a cumulative counter of the filesystem stats
+type fsCounter struct {
+	name  string
+	value func(fs *info.FsStats) uint64
+}
+
+var containerCounters = []containerCounter{
+	{"Cpu.Usage.Total", func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.Total }},
+	{"Cpu.Usage.User", func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.User }},
+	{"Cpu.Usage.System", func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.System }},
+	{"Network.RxBytes", func(s *info.ContainerStats) uint64 { return s.Network.RxBytes }},
+	{"Network.RxPackets", func(s *info.ContainerStats) uint64 { return s.Network.RxPackets }},
+	{"Network.RxErrors", func(s *info.ContainerStats) uint64 { return s.Network.RxErrors }},
+	{"Network.RxDropped", func(s *info.ContainerStats) uint64 { return s.Network.RxDropped }},
+	{"Network.TxBytes", func(s *info.ContainerStats) uint64 { return s.Network.TxBytes }},
+	{"Network.TxPackets", func(s *info.ContainerStats) uint64 { return s.Network.TxPackets }},
+	{"Network.TxErrors", func(s *info.ContainerStats) uint64 { return s.Network.TxErrors }},
+	{"Network.TxDropped", func(s *info.ContainerStats) uint64 { return s.Network.TxDropped }},
+	// Page faults of the container alone, and of the container along with its children
+	{"Memory.Pgminfault", func(s *info.ContainerStats) uint64 { return minorFaults(s.Memory.ContainerData) }},
+	{"Memory.Pgmajfault", func(s *info.ContainerStats) uint64 { return s.Memory.ContainerData.Pgmajfault }},
+	{"Memory.Hierarchical.Pgminfault", func(s *info.ContainerStats) uint64 { return minorFaults(s.Memory.HierarchicalData) }},
+	{"Memory.Hierarchical.Pgmajfault", func(s *info.ContainerStats) uint64 { return s.Memory.HierarchicalData.Pgmajfault }},
+}
+
+// minorFaults is the number of minor page faults, the pgfault counter of cgroups counting major ones too
+func minorFaults(data info.MemoryStatsMemoryData) uint64 {
+	if data.Pgmajfault > data.Pgfault {
+		return 0
+	}
+	return data.Pgfault - data.Pgmajfault
+}
+
+var fsCounters = []fsCounter{
+	{"Filesystem.ReadsCompleted", func(fs *info.FsStats) uint64 { return fs.ReadsCompleted }},
+	{"Filesystem.ReadsMerged", func(fs *info.FsStats) uint64 { return fs.ReadsMerged }},
+	{"Filesystem.SectorsRead", func(fs *info.FsStats) uint64 { return fs.SectorsRead }},
+	{"Filesystem.ReadTime", func(fs *info.FsStats) uint64 { return fs.ReadTime }},
+	{"Filesystem.WritesCompleted", func(fs *info.FsStats) uint64 { return fs.WritesCompleted }},
+	{"Filesystem.WritesMerged", func(fs *info.FsStats) uint64 { return fs.WritesMerged }},
+	{"Filesystem.SectorsWritten", func(fs *info.FsStats) uint64 { return fs.SectorsWritten }},
+	{"Filesystem.WriteTime", func(fs *info.FsStats) uint64 { return fs.WriteTime }},
+	{"Filesystem.IoTime", func(fs *info.FsStats) uint64 { return fs.IoTime }},
+	{"Filesystem.WeightedIoTime", func(fs *info.FsStats) uint64 { return fs.WeightedIoTime }},
+}
+
+// rateWindow returns the two stats to compute rates between: the newest one of the window,
+// and the newest one of the previous cycle, or the oldest one of the window on the first cycle.
+// from is nil when there isn't enough data.
+func rateWindow(prev *info.ContainerStats, stats []*info.ContainerStats) (from, to *info.ContainerStats) {
+	if len(stats) == 0 {
+		return nil, nil
+	}
+	to = stats[len(stats)-1]
+	if prev != nil && prev.Timestamp.Before(to.Timestamp) {
+		return prev, to
+	}
+	if len(stats) >= 2 {
+		return stats[0], to
+	}
+	return nil, nil
+}
+
+// counterDelta returns how much a cumulative counter grew from prev to cur.
+// A counter going backwards was reset, typically because the container restarted
+// and its cgroup counters started again from zero: reset is then true, and ok tells
+// whether the interval is still usable. With the rebase policy the counter is
+// assumed to have grown from zero up to cur, with the skip policy it is not.
+func counterDelta(prev, cur uint64) (delta uint64, reset bool, ok bool) {
+	if cur >= prev {
+		return cur - prev, false, true
+	}
+	if *counterResetPolicy == "rebase" {
+		return cur, true, true
+	}
+	return 0, true, false
+}
+
+// counterRate is the per-second rate of a cumulative counter going from prev to cur over interval,
+// see counterDelta for reset and ok
+func counterRate(prev, cur uint64, interval time.Duration) (rate float64, reset bool, ok bool) {
+	delta, reset, ok := counterDelta(prev, cur)
+	if !ok || interval <= 0 {
+		return 0, reset, false
+	}
+	return roundDecimals(float64(delta)/interval.Seconds(), 2), reset, true
+}
+
+// roundDecimals rounds x to places decimal places. Unlike roundFloat, which keeps
+// significant digits, it doesn't lose the precision of large values.
+func roundDecimals(x float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(x*scale) / scale
+}
+
+// addCounterResets reports the counters of subj that were reset during the cycle, if any
+func (col *collector) addCounterResets(samples []Sample, subj subject, resets []string) []Sample {
+	if len(resets) == 0 {
+		return samples
+	}
+	glog.Infof("counters of %s were reset: %s", subj.label(), strings.Join(resets, ", "))
+	samples = col.addSample(samples, "Counters.Reset", subj, len(resets))
+	samples[len(samples)-1].Description = fmt.Sprintf("reset: %s", strings.Join(resets, ", "))
+	return samples
+}
+
+// sectorSize is the unit of the sector counters of the filesystem stats
+const sectorSize = 512
+
+// addFsIostat appends the iostat-like metrics of a device between from and to: utilization, average queue size,
+// read and write throughput, and average await. Intervals during which a counter was reset are skipped.
+func (col *collector) addFsIostat(samples []Sample, subj subject, from, to *info.FsStats, interval time.Duration) []Sample {
+	deltas := make(map[string]float64)
+	for _, counter := range fsCounters {
+		delta, reset, ok := counterDelta(counter.value(from), counter.value(to))
+		if reset || !ok {
+			return samples
+		}
+		deltas[counter.name] = float64(delta)
+	}
+	ms := float64(interval.Nanoseconds()) / 1e6
+	if ms <= 0 {
+		return samples
+	}
+
+	// Times are in milliseconds
+	samples = col.addSample(samples, "Filesystem.UtilPercent", subj, roundDecimals(math.Min(deltas["Filesystem.IoTime"]/ms*100, 100), 2))
+	samples = col.addSample(samples, "Filesystem.AvgQueueSize", subj, roundDecimals(deltas["Filesystem.WeightedIoTime"]/ms, 2))
+	samples = col.addSample(samples, "Filesystem.ReadBytes.Rate", subj, roundDecimals(deltas["Filesystem.SectorsRead"]*sectorSize/interval.Seconds(), 2))
+	samples = col.addSample(samples, "Filesystem.WriteBytes.Rate", subj, roundDecimals(deltas["Filesystem.SectorsWritten"]*sectorSize/interval.Seconds(), 2))
+
+	reads, writes := deltas["Filesystem.ReadsCompleted"], deltas["Filesystem.WritesCompleted"]
+	if reads > 0 {
+		samples = col.addSample(samples, "Filesystem.ReadAwaitMs", subj, roundDecimals(deltas["Filesystem.ReadTime"]/reads, 2))
+	}
+	if writes > 0 {
+		samples = col.addSample(samples, "Filesystem.WriteAwaitMs", subj, roundDecimals(deltas["Filesystem.WriteTime"]/writes, 2))
+	}
+	if reads+writes > 0 {
+		samples = col.addSample(samples, "Filesystem.AwaitMs", subj, roundDecimals((deltas["Filesystem.ReadTime"]+deltas["Filesystem.WriteTime"])/(reads+writes), 2))
+	}
+	return samples
+}
+
+// findFsStats returns the stats of device, nil when the container has none
+func findFsStats(stats *info.ContainerStats, device string) *info.FsStats {
+	for i := range stats.Filesystem {
+		if stats.Filesystem[i].Device == device {
+			return &stats.Filesystem[i]
+		}
+	}
+	return nil
+}
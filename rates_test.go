@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+func TestCounterDelta(t *testing.T) {
+	defer func(policy string) { *counterResetPolicy = policy }(*counterResetPolicy)
+
+	tests := []struct {
+		policy    string
+		prev, cur uint64
+		delta     uint64
+		reset, ok bool
+	}{
+		{"skip", 100, 150, 50, false, true},
+		{"skip", 100, 100, 0, false, true},
+		{"skip", 100, 30, 0, true, false},
+		{"rebase", 100, 150, 50, false, true},
+		{"rebase", 100, 30, 30, true, true},
+	}
+	for _, test := range tests {
+		*counterResetPolicy = test.policy
+		delta, reset, ok := counterDelta(test.prev, test.cur)
+		if delta != test.delta || reset != test.reset || ok != test.ok {
+			t.Errorf("%s: counterDelta(%d, %d) = %d, %v, %v, want %d, %v, %v",
+				test.policy, test.prev, test.cur, delta, reset, ok, test.delta, test.reset, test.ok)
+		}
+	}
+}
+
+func TestCounterRate(t *testing.T) {
+	defer func(policy string) { *counterResetPolicy = policy }(*counterResetPolicy)
+	*counterResetPolicy = "skip"
+
+	tests := []struct {
+		prev, cur uint64
+		interval  time.Duration
+		rate      float64
+		reset, ok bool
+	}{
+		{0, 12345678, 10 * time.Second, 1234567.8, false, true},
+		{0, 987654, 10 * time.Second, 98765.4, false, true},
+		{0, 1, 3 * time.Second, 0.33, false, true},
+		{100, 100, time.Second, 0, false, true},
+		{100, 50, time.Second, 0, true, false},
+		{0, 100, 0, 0, false, false},
+	}
+	for _, test := range tests {
+		rate, reset, ok := counterRate(test.prev, test.cur, test.interval)
+		if rate != test.rate || reset != test.reset || ok != test.ok {
+			t.Errorf("counterRate(%d, %d, %s) = %v, %v, %v, want %v, %v, %v",
+				test.prev, test.cur, test.interval, rate, reset, ok, test.rate, test.reset, test.ok)
+		}
+	}
+}
+
+func TestRoundDecimals(t *testing.T) {
+	tests := []struct {
+		x      float64
+		places int
+		want   float64
+	}{
+		{1234567.891, 2, 1234567.89},
+		{98765.4, 2, 98765.4},
+		{0.0001234, 3, 0},
+		{2.5, 0, 3},
+	}
+	for _, test := range tests {
+		if got := roundDecimals(test.x, test.places); got != test.want {
+			t.Errorf("roundDecimals(%v, %d) = %v, want %v", test.x, test.places, got, test.want)
+		}
+	}
+}
+
+func TestMinorFaults(t *testing.T) {
+	tests := []struct {
+		pgfault, pgmajfault uint64
+		minor               uint64
+	}{
+		{1000, 10, 990},
+		{1000, 0, 1000},
+		{10, 10, 0},
+		{5, 10, 0},
+	}
+	for _, test := range tests {
+		data := info.MemoryStatsMemoryData{Pgfault: test.pgfault, Pgmajfault: test.pgmajfault}
+		if minor := minorFaults(data); minor != test.minor {
+			t.Errorf("minorFaults(pgfault %d, pgmajfault %d) = %d, want %d", test.pgfault, test.pgmajfault, minor, test.minor)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/bigdatadev/goryman"
+	"github.com/golang/glog"
+)
+
+var maxMessageRiemann = flag.Int("riemann_max_message_size", goryman.MAX_MESSAGE_SIZE, "specify the maximum size in bytes of a message sent to riemann (default 1MB)")
+var reconnectMinRiemann = flag.Duration("riemann_reconnect_min", time.Second, "specify the initial delay before redialing riemann after a connection loss (default 1s)")
+var reconnectMaxRiemann = flag.Duration("riemann_reconnect_max", time.Minute, "specify the maximum delay between two attempts to redial riemann (default 1m)")
+var sendStatesRiemann = flag.Bool("riemann_send_states", false, "specify whether to send a riemann state whenever the state of a metric changes (default false)")
+var udpRiemann = flag.Bool("riemann_udp", true, "specify whether small messages may be sent to riemann over UDP, unacknowledged; disabled with a spool (default true)")
+var tlsRiemann = flag.Bool("riemann_tls", false, "specify whether to connect to riemann over TLS, which disables UDP (default false)")
+var tlsCARiemann = flag.String("riemann_tls_ca", "", "specify the PEM bundle of the authorities signing the riemann certificate (default '', system ones)")
+var tlsCertRiemann = flag.String("riemann_tls_cert", "", "specify the PEM client certificate for mutual TLS (default '')")
+var tlsKeyRiemann = flag.String("riemann_tls_key", "", "specify the PEM key of the client certificate (default '')")
+var tlsServerNameRiemann = flag.String("riemann_tls_server_name", "", "specify the name expected in the riemann certificate (default '', host of riemann_address)")
+var tlsSkipVerifyRiemann = flag.Bool("riemann_tls_skip_verify", false, "specify whether to skip the verification of the riemann certificate, for lab use only (default false)")
+
+// riemannSink sends samples as events to a Riemann server, and optionally
+// a state update whenever the state of a sample changes.
+// With a spool, the events that can't be delivered are kept on disk and
+// replayed once Riemann is back.
+type riemannSink struct {
+	client     *goryman.GorymanClient
+	sendStates bool
+	spool      *spool
+
+	// The spool is reported on the host of the agent, once per sampling interval
+	// however many cadvisors are polled
+	host     string
+	ttl      float32
+	interval time.Duration
+	reported time.Time
+}
+
+func newRiemannSink(client *goryman.GorymanClient, sendStates bool, sp *spool, host string, ttl float32, interval time.Duration) *riemannSink {
+	return &riemannSink{
+		client:     client,
+		sendStates: sendStates,
+		spool:      sp,
+		host:       host,
+		ttl:        ttl,
+		interval:   interval,
+	}
+}
+
+func sampleToEvent(s *Sample) *goryman.Event {
+	return &goryman.Event{
+		Host:        s.Host,
+		Service:     s.Service,
+		Metric:      s.Metric,
+		Ttl:         s.Ttl,
+		Tags:        s.Tags,
+		State:       s.State,
+		Description: s.Description,
+		Attributes:  s.Attributes,
+		Time:        s.Time,
+	}
+}
+
+// sampleToState builds the state update of a sample whose state changed,
+// Riemann states have no metric so the value goes in the description
+func sampleToState(s *Sample) *goryman.State {
+	description := fmt.Sprintf("%s changed from %s to %s, value %v", s.Service, s.Previous, s.State, s.Metric)
+	if s.Description != "" {
+		description = fmt.Sprintf("%s (%s)", description, s.Description)
+	}
+	return &goryman.State{
+		Host:        s.Host,
+		Service:     s.Service,
+		Ttl:         s.Ttl,
+		Tags:        s.Tags,
+		State:       s.State,
+		Once:        true,
+		Description: description,
+		Time:        s.Time,
+	}
+}
+
+// Emit sends the whole batch at once, goryman packs it into as few messages as possible.
+// Spooled events go first, so that Riemann gets them in order.
+func (s *riemannSink) Emit(samples []Sample) error {
+	if s.spool == nil {
+		_, err := s.send(samples)
+		return err
+	}
+
+	samples = append(samples, s.spoolSamples(time.Now())...)
+	delivered := 0
+	err := s.spool.replay(s.sendEvents)
+	if err == nil {
+		delivered, err = s.send(samples)
+	}
+	// Only the events Riemann didn't acknowledge are spooled, states aren't replayed
+	if err != nil && delivered < len(samples) {
+		if spoolErr := s.spool.append(samples[delivered:]); spoolErr != nil {
+			glog.Errorf("unable to spool %d samples: %s", len(samples)-delivered, spoolErr)
+		}
+	}
+	return err
+}
+
+// spoolSamples reports how much the spool has been used, unless it was reported already during
+// the interval: the batches of the cadvisors of a cycle come within half an interval of each other
+func (s *riemannSink) spoolSamples(now time.Time) []Sample {
+	if now.Sub(s.reported) < s.interval/2 {
+		return nil
+	}
+	s.reported = now
+
+	var spoolSamples []Sample
+	for _, counter := range []struct {
+		name  string
+		value int
+	}{
+		{"Spool.Spooled", s.spool.spooled},
+		{"Spool.Dropped", s.spool.dropped},
+		{"Spool.Replayed", s.spool.replayed},
+		{"Spool.Bytes", int(s.spool.size)},
+	} {
+		spoolSamples = append(spoolSamples, Sample{
+			Host:    s.host,
+			Service: counter.name,
+			Metric:  counter.value,
+			Ttl:     s.ttl,
+			Time:    now.Unix(),
+			Name:    counter.name,
+		})
+	}
+	return spoolSamples
+}
+
+// sendEvents sends samples as events only, and returns how many of them were delivered
+func (s *riemannSink) sendEvents(samples []Sample) (int, error) {
+	events := make([]*goryman.Event, len(samples))
+	for i := range samples {
+		events[i] = sampleToEvent(&samples[i])
+	}
+	return s.client.DeliverEvents(events)
+}
+
+// send sends samples as events, and their state changes as states when enabled.
+// It returns how many events were delivered, all of them when only a state failed.
+func (s *riemannSink) send(samples []Sample) (int, error) {
+	delivered, err := s.sendEvents(samples)
+	if err != nil || !s.sendStates {
+		return delivered, err
+	}
+	for i := range samples {
+		if samples[i].Previous == "" {
+			continue
+		}
+		if err := s.client.SendState(sampleToState(&samples[i])); err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
+
+func (s *riemannSink) Flush() error {
+	return nil
+}
+
+func (s *riemannSink) Close() error {
+	return s.client.Close()
+}
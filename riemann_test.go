@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSpoolSamplesOncePerInterval(t *testing.T) {
+	sp, dir := tempSpool(t, 1<<20, time.Hour)
+	defer os.RemoveAll(dir)
+	s := newRiemannSink(nil, false, sp, "agent", 20, 10*time.Second)
+
+	start := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		at       time.Duration
+		reported bool
+	}{
+		{0, true},
+		// The batches of the other cadvisors of the cycle
+		{10 * time.Millisecond, false},
+		{2 * time.Second, false},
+		// Next cycle, the ticker firing a little early
+		{9990 * time.Millisecond, true},
+		{10 * time.Second, false},
+		{20 * time.Second, true},
+	}
+	for _, test := range tests {
+		samples := s.spoolSamples(start.Add(test.at))
+		if (samples != nil) != test.reported {
+			t.Errorf("at %s: reported %d samples, want reported %v", test.at, len(samples), test.reported)
+		}
+		for _, sample := range samples {
+			if sample.Host != "agent" {
+				t.Errorf("at %s: %s reported on host %q, want the agent", test.at, sample.Service, sample.Host)
+			}
+		}
+	}
+}
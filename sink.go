@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+var sinkQueueSize = flag.Int("sink_queue_size", 10, "specify how many cycles a sink may lag behind before samples are dropped (default 10)")
+
+// Sample is a single data point derived from cadvisor stats during a sampling cycle
+type Sample struct {
+	Host        string
+	Service     string
+	Metric      interface{} // Could be Int, Float32, Float64
+	Ttl         float32
+	Tags        []string
+	State       string
+	Description string
+	Attributes  map[string]string
+	Time        int64
+
+	// State of the previous cycle, only set when State changed
+	Previous string
+
+	// What the sample is about, for sinks that don't flatten it into Service and Tags
+	Name      string
+	Container string
+	Aliases   []string
+	Namespace string
+	Device    string
+}
+
+// Sink is a destination for the samples produced by each sampling cycle
+type Sink interface {
+	// Emit hands a batch of samples over to the sink
+	Emit(samples []Sample) error
+	// Flush pushes anything the sink is still holding to its backend
+	Flush() error
+	// Close flushes and releases the sink
+	Close() error
+}
+
+// asyncSink runs a Sink in its own goroutine, so that a failing or slow
+// backend never holds up the collection loop nor the other sinks
+type asyncSink struct {
+	name  string
+	sink  Sink
+	queue chan []Sample
+	done  chan struct{}
+}
+
+func newAsyncSink(name string, sink Sink, queueSize int) *asyncSink {
+	s := &asyncSink{
+		name:  name,
+		sink:  sink,
+		queue: make(chan []Sample, queueSize),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *asyncSink) run() {
+	defer close(s.done)
+	for samples := range s.queue {
+		if err := s.sink.Emit(samples); err != nil {
+			glog.Errorf("sink %s: unable to emit %d samples: %s", s.name, len(samples), err)
+			continue
+		}
+		if err := s.sink.Flush(); err != nil {
+			glog.Errorf("sink %s: unable to flush: %s", s.name, err)
+		}
+	}
+}
+
+// Emit queues the batch, dropping it when the sink is too far behind
+func (s *asyncSink) Emit(samples []Sample) error {
+	select {
+	case s.queue <- samples:
+	default:
+		glog.Warningf("sink %s: queue full, dropping %d samples", s.name, len(samples))
+	}
+	return nil
+}
+
+func (s *asyncSink) Flush() error {
+	return nil
+}
+
+// Close waits for the queued batches to drain before closing the wrapped sink
+func (s *asyncSink) Close() error {
+	close(s.queue)
+	<-s.done
+	return s.sink.Close()
+}
+
+// fanoutSink sends every batch to all of its sinks
+type fanoutSink struct {
+	sinks []Sink
+}
+
+func newFanoutSink(sinks ...Sink) *fanoutSink {
+	return &fanoutSink{sinks: sinks}
+}
+
+func (f *fanoutSink) Emit(samples []Sample) error {
+	for _, s := range f.sinks {
+		if err := s.Emit(samples); err != nil {
+			glog.Errorf("unable to emit samples: %s", err)
+		}
+	}
+	return nil
+}
+
+func (f *fanoutSink) Flush() error {
+	for _, s := range f.sinks {
+		if err := s.Flush(); err != nil {
+			glog.Errorf("unable to flush sink: %s", err)
+		}
+	}
+	return nil
+}
+
+func (f *fanoutSink) Close() error {
+	var wg sync.WaitGroup
+	for _, s := range f.sinks {
+		wg.Add(1)
+		go func(s Sink) {
+			defer wg.Done()
+			if err := s.Close(); err != nil {
+				glog.Errorf("unable to close sink: %s", err)
+			}
+		}(s)
+	}
+	wg.Wait()
+	return nil
+}
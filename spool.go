@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+var spoolDir = flag.String("spool_dir", "", "specify a directory to spool events in while riemann is unreachable (default '', disabled)")
+var spoolMaxSize = flag.Int64("spool_max_size", 100<<20, "specify the maximum size in bytes of the spool, oldest events being dropped first (default 100MB)")
+var spoolMaxAge = flag.Duration("spool_max_age", time.Hour, "specify the age beyond which spooled events are dropped instead of replayed (default 1h)")
+
+// spoolSegmentSize is the size beyond which the spool starts a new segment file
+const spoolSegmentSize = 1 << 20
+
+// segment is a spool file, holding one JSON encoded sample per line
+type segment struct {
+	path  string
+	size  int64
+	count int
+}
+
+// spool keeps on disk the samples that couldn't be delivered, until they can be replayed.
+// It is bounded in size, dropping its oldest segments first, and in age, dropping
+// the samples that are too old to be worth replaying.
+type spool struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+
+	// Oldest first, the last one being appended to
+	segments []*segment
+	size     int64
+
+	// Number of samples spooled, dropped and replayed since startup
+	spooled  int
+	dropped  int
+	replayed int
+}
+
+// newSpool opens the spool in dir, picking up the segments left by a previous run
+func newSpool(dir string, maxSize int64, maxAge time.Duration) (*spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.spool"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	sp := &spool{
+		dir:     dir,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		seg := &segment{
+			path:  path,
+			size:  int64(len(data)),
+			count: bytes.Count(data, []byte("\n")),
+		}
+		sp.segments = append(sp.segments, seg)
+		sp.size += seg.size
+	}
+	return sp, nil
+}
+
+func (sp *spool) empty() bool {
+	return len(sp.segments) == 0
+}
+
+// encodeSamples encodes samples one per line, leaving out the ones that can't be encoded,
+// such as those with a NaN or infinite metric, and returns how many were encoded
+func encodeSamples(samples []Sample) ([]byte, int) {
+	b := new(bytes.Buffer)
+	encoded := 0
+	for i := range samples {
+		line, err := json.Marshal(&samples[i])
+		if err != nil {
+			glog.Warningf("unable to spool %s of %s: %s", samples[i].Service, samples[i].Host, err)
+			continue
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+		encoded++
+	}
+	return b.Bytes(), encoded
+}
+
+// append writes samples at the end of the spool, then drops the oldest segments beyond the size limit.
+// Samples that can't be encoded are dropped.
+func (sp *spool) append(samples []Sample) error {
+	data, encoded := encodeSamples(samples)
+	sp.dropped += len(samples) - encoded
+	if encoded == 0 {
+		return nil
+	}
+
+	if sp.empty() || sp.segments[len(sp.segments)-1].size+int64(len(data)) > spoolSegmentSize {
+		sp.segments = append(sp.segments, &segment{
+			path: filepath.Join(sp.dir, fmt.Sprintf("%020d.spool", time.Now().UnixNano())),
+		})
+	}
+	seg := sp.segments[len(sp.segments)-1]
+
+	f, err := os.OpenFile(seg.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		sp.dropped += encoded
+		return err
+	}
+	seg.size += int64(len(data))
+	seg.count += encoded
+	sp.size += int64(len(data))
+	sp.spooled += encoded
+
+	for sp.size > sp.maxSize && len(sp.segments) > 1 {
+		sp.dropped += sp.segments[0].count
+		sp.remove()
+	}
+	return nil
+}
+
+// replay hands the spooled samples over to send, oldest first, send returning how many
+// of them were delivered. Segments are removed once sent, replay stops at the first one
+// that send fails on, which then only keeps the samples that weren't delivered.
+func (sp *spool) replay(send func(samples []Sample) (int, error)) error {
+	for !sp.empty() {
+		samples, err := readSegment(sp.segments[0].path)
+		if err != nil {
+			return err
+		}
+
+		fresh := samples[:0]
+		oldest := time.Now().Add(-sp.maxAge).Unix()
+		for _, sample := range samples {
+			if sample.Time >= oldest {
+				fresh = append(fresh, sample)
+			}
+		}
+		sp.dropped += len(samples) - len(fresh)
+
+		if len(fresh) > 0 {
+			delivered, err := send(fresh)
+			sp.replayed += delivered
+			if err != nil {
+				if rewriteErr := sp.rewrite(fresh[delivered:]); rewriteErr != nil {
+					return rewriteErr
+				}
+				return err
+			}
+		}
+		sp.remove()
+	}
+	return nil
+}
+
+// rewrite replaces the content of the oldest segment with samples
+func (sp *spool) rewrite(samples []Sample) error {
+	seg := sp.segments[0]
+	data, encoded := encodeSamples(samples)
+
+	// Written aside then renamed, so that a crash leaves either version of the segment
+	tmp := seg.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, seg.path); err != nil {
+		return err
+	}
+	sp.size += int64(len(data)) - seg.size
+	seg.size = int64(len(data))
+	seg.count = encoded
+	return nil
+}
+
+// remove deletes the oldest segment
+func (sp *spool) remove() {
+	seg := sp.segments[0]
+	os.Remove(seg.path)
+	sp.segments = sp.segments[1:]
+	sp.size -= seg.size
+}
+
+func readSegment(path string) ([]Sample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var samples []Sample
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), spoolSegmentSize)
+	for scanner.Scan() {
+		var sample Sample
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.UseNumber()
+		if err = decoder.Decode(&sample); err != nil {
+			// A line cut short by a crash, skip it
+			continue
+		}
+		sample.Metric = spooledMetric(sample.Metric)
+		samples = append(samples, sample)
+	}
+	return samples, scanner.Err()
+}
+
+// spooledMetric restores the type of a metric read back from the spool
+func spooledMetric(metric interface{}) interface{} {
+	number, ok := metric.(json.Number)
+	if !ok {
+		return metric
+	}
+	if !strings.ContainsAny(number.String(), ".eE") {
+		if i, err := number.Int64(); err == nil {
+			return int(i)
+		}
+	}
+	f, _ := number.Float64()
+	return f
+}
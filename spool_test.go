@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tempSpool(t *testing.T, maxSize int64, maxAge time.Duration) (*spool, string) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp, err := newSpool(dir, maxSize, maxAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sp, dir
+}
+
+func spoolBatch(services ...string) []Sample {
+	var samples []Sample
+	for i, service := range services {
+		samples = append(samples, Sample{Host: "h", Service: service, Metric: i, Time: time.Now().Unix()})
+	}
+	return samples
+}
+
+// replayAll replays the spool, delivering everything, and returns the services replayed
+func replayAll(t *testing.T, sp *spool) []string {
+	var services []string
+	err := sp.replay(func(samples []Sample) (int, error) {
+		for _, sample := range samples {
+			services = append(services, sample.Service)
+		}
+		return len(samples), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return services
+}
+
+func TestSpoolRoundTrip(t *testing.T) {
+	sp, dir := tempSpool(t, 1<<20, time.Hour)
+	defer os.RemoveAll(dir)
+
+	batch := spoolBatch("a", "b")
+	batch[1].Metric = 1.5
+	if err := sp.append(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := sp.append(spoolBatch("c")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new spool on the same directory picks up what was left
+	sp, err := newSpool(dir, 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replayed []Sample
+	err = sp.replay(func(samples []Sample) (int, error) {
+		replayed = append(replayed, samples...)
+		return len(samples), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed) != 3 || replayed[0].Service != "a" || replayed[2].Service != "c" {
+		t.Fatalf("replayed %v, want a, b and c in order", replayed)
+	}
+	if metric, ok := replayed[0].Metric.(int); !ok || metric != 0 {
+		t.Errorf("metric of a = %#v, want int 0", replayed[0].Metric)
+	}
+	if metric, ok := replayed[1].Metric.(float64); !ok || metric != 1.5 {
+		t.Errorf("metric of b = %#v, want float64 1.5", replayed[1].Metric)
+	}
+	if !sp.empty() || sp.size != 0 || sp.replayed != 3 {
+		t.Errorf("spool after replay: empty %v, size %d, replayed %d", sp.empty(), sp.size, sp.replayed)
+	}
+}
+
+func TestSpoolDropsOldSamples(t *testing.T) {
+	sp, dir := tempSpool(t, 1<<20, time.Minute)
+	defer os.RemoveAll(dir)
+
+	batch := spoolBatch("old", "fresh")
+	batch[0].Time = time.Now().Add(-time.Hour).Unix()
+	if err := sp.append(batch); err != nil {
+		t.Fatal(err)
+	}
+	if services := replayAll(t, sp); len(services) != 1 || services[0] != "fresh" {
+		t.Errorf("replayed %v, want fresh only", services)
+	}
+	if sp.dropped != 1 {
+		t.Errorf("dropped %d, want 1", sp.dropped)
+	}
+}
+
+func TestSpoolKeepsUndelivered(t *testing.T) {
+	sp, dir := tempSpool(t, 1<<20, time.Hour)
+	defer os.RemoveAll(dir)
+
+	if err := sp.append(spoolBatch("a", "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+	failure := errors.New("riemann is down")
+	err := sp.replay(func(samples []Sample) (int, error) {
+		return 1, failure
+	})
+	if err != failure {
+		t.Fatalf("replay returned %v, want %v", err, failure)
+	}
+	if services := replayAll(t, sp); strings.Join(services, ",") != "b,c" {
+		t.Errorf("replayed %v after a partial delivery, want b and c", services)
+	}
+}
+
+func TestSpoolMaxSize(t *testing.T) {
+	sp, dir := tempSpool(t, spoolSegmentSize, time.Hour)
+	defer os.RemoveAll(dir)
+
+	// Each batch takes more than half a segment, so that each one starts a new segment
+	big := strings.Repeat("x", spoolSegmentSize*3/5)
+	for _, service := range []string{"a", "b", "c"} {
+		batch := spoolBatch(service)
+		batch[0].Description = big
+		if err := sp.append(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sp.size > sp.maxSize {
+		t.Errorf("spool size %d beyond %d", sp.size, sp.maxSize)
+	}
+	if services := replayAll(t, sp); strings.Join(services, ",") != "c" {
+		t.Errorf("replayed %v, want the newest batch only", services)
+	}
+	if sp.dropped != 2 {
+		t.Errorf("dropped %d, want 2", sp.dropped)
+	}
+}
+
+func TestSpoolDropsUnencodable(t *testing.T) {
+	sp, dir := tempSpool(t, 1<<20, time.Hour)
+	defer os.RemoveAll(dir)
+
+	batch := spoolBatch("a", "b", "c", "d")
+	batch[1].Metric = math.NaN()
+	batch[3].Metric = math.Inf(1)
+	if err := sp.append(batch); err != nil {
+		t.Fatal(err)
+	}
+	if sp.spooled != 2 || sp.dropped != 2 {
+		t.Errorf("spooled %d and dropped %d samples, want 2 and 2", sp.spooled, sp.dropped)
+	}
+	if services := replayAll(t, sp); strings.Join(services, ",") != "a,c" {
+		t.Errorf("replayed %v, want a and c", services)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+)
+
+// ThresholdRule sets the warning and critical levels of a metric.
+// By default values above a level are bad, inverted rules consider values below
+// a level as bad, and range rules consider values outside of [min, max] as bad.
+type ThresholdRule struct {
+	Warning  *float64 `json:"warning,omitempty"`
+	Critical *float64 `json:"critical,omitempty"`
+	Inverted bool     `json:"inverted,omitempty"`
+
+	WarningRange  []float64 `json:"warning_range,omitempty"`
+	CriticalRange []float64 `json:"critical_range,omitempty"`
+
+	// Levels (or ranges) a value must get back within before a raised state clears,
+	// the raise levels when unset
+	WarningClear       *float64  `json:"warning_clear,omitempty"`
+	CriticalClear      *float64  `json:"critical_clear,omitempty"`
+	WarningClearRange  []float64 `json:"warning_clear_range,omitempty"`
+	CriticalClearRange []float64 `json:"critical_clear_range,omitempty"`
+
+	// How many consecutive cycles, and for how long, a new state must hold before it is reported
+	ForCycles int      `json:"for_cycles,omitempty"`
+	For       duration `json:"for,omitempty"`
+}
+
+func (r *ThresholdRule) validate() error {
+	if r == nil {
+		return fmt.Errorf("no rule")
+	}
+	levels := r.Warning != nil || r.Critical != nil || r.WarningClear != nil || r.CriticalClear != nil
+	ranges := r.WarningRange != nil || r.CriticalRange != nil || r.WarningClearRange != nil || r.CriticalClearRange != nil
+	if levels && ranges {
+		return fmt.Errorf("levels and ranges can't be mixed")
+	}
+	if r.Inverted && ranges {
+		return fmt.Errorf("range rules can't be inverted")
+	}
+	if r.ForCycles < 0 || r.For < 0 {
+		return fmt.Errorf("for_cycles and for can't be negative")
+	}
+	for _, levels := range [][]float64{r.WarningRange, r.CriticalRange, r.WarningClearRange, r.CriticalClearRange} {
+		if levels == nil {
+			continue
+		}
+		if len(levels) != 2 || levels[0] > levels[1] {
+			return fmt.Errorf("a range must be [min, max], got %v", levels)
+		}
+	}
+	if ranges {
+		return r.validateRanges()
+	}
+	return r.validateLevels()
+}
+
+// validateLevels checks that levels are ordered: critical beyond warning, and each clear level
+// on the good side of its level, which would otherwise lower the threshold instead of adding hysteresis
+func (r *ThresholdRule) validateLevels() error {
+	// beyond tells whether a is further than b on the bad side
+	beyond := func(a, b float64) bool {
+		if r.Inverted {
+			return a < b
+		}
+		return a > b
+	}
+	if r.WarningClear != nil && r.Warning == nil {
+		return fmt.Errorf("warning_clear without warning")
+	}
+	if r.CriticalClear != nil && r.Critical == nil {
+		return fmt.Errorf("critical_clear without critical")
+	}
+	if r.Warning != nil && r.Critical != nil && beyond(*r.Warning, *r.Critical) {
+		return fmt.Errorf("warning %v is beyond critical %v", *r.Warning, *r.Critical)
+	}
+	if r.WarningClear != nil && beyond(*r.WarningClear, *r.Warning) {
+		return fmt.Errorf("warning_clear %v is beyond warning %v", *r.WarningClear, *r.Warning)
+	}
+	if r.CriticalClear != nil && beyond(*r.CriticalClear, *r.Critical) {
+		return fmt.Errorf("critical_clear %v is beyond critical %v", *r.CriticalClear, *r.Critical)
+	}
+	return nil
+}
+
+// validateRanges checks that ranges are nested: the critical range around the warning one,
+// and each clear range within its range
+func (r *ThresholdRule) validateRanges() error {
+	within := func(inner, outer []float64) bool {
+		return inner[0] >= outer[0] && inner[1] <= outer[1]
+	}
+	if r.WarningClearRange != nil && r.WarningRange == nil {
+		return fmt.Errorf("warning_clear_range without warning_range")
+	}
+	if r.CriticalClearRange != nil && r.CriticalRange == nil {
+		return fmt.Errorf("critical_clear_range without critical_range")
+	}
+	if r.WarningRange != nil && r.CriticalRange != nil && !within(r.WarningRange, r.CriticalRange) {
+		return fmt.Errorf("warning_range %v is not within critical_range %v", r.WarningRange, r.CriticalRange)
+	}
+	if r.WarningClearRange != nil && !within(r.WarningClearRange, r.WarningRange) {
+		return fmt.Errorf("warning_clear_range %v is not within warning_range %v", r.WarningClearRange, r.WarningRange)
+	}
+	if r.CriticalClearRange != nil && !within(r.CriticalClearRange, r.CriticalRange) {
+		return fmt.Errorf("critical_clear_range %v is not within critical_range %v", r.CriticalClearRange, r.CriticalRange)
+	}
+	return nil
+}
+
+// breaks tells whether value is beyond level, or out of levelRange for range rules
+func (r *ThresholdRule) breaks(level *float64, levelRange []float64, value float64) bool {
+	switch {
+	case levelRange != nil:
+		return value < levelRange[0] || value > levelRange[1]
+	case level == nil:
+		return false
+	case r.Inverted:
+		return value < *level
+	}
+	return value > *level
+}
+
+// state returns ok, warning or critical for value, current being the state reported so far.
+// A raised state is kept as long as value didn't get back within its clear level.
+func (r *ThresholdRule) state(value float64, current string) string {
+	critical := r.breaks(r.Critical, r.CriticalRange, value)
+	if !critical && current == "critical" {
+		critical = r.breaks(r.clearLevel(r.CriticalClear, r.Critical), r.clearRange(r.CriticalClearRange, r.CriticalRange), value)
+	}
+	if critical {
+		return "critical"
+	}
+
+	warning := r.breaks(r.Warning, r.WarningRange, value)
+	if !warning && (current == "warning" || current == "critical") {
+		warning = r.breaks(r.clearLevel(r.WarningClear, r.Warning), r.clearRange(r.WarningClearRange, r.WarningRange), value)
+	}
+	if warning {
+		return "warning"
+	}
+	return "ok"
+}
+
+func (r *ThresholdRule) clearLevel(clear *float64, level *float64) *float64 {
+	if clear != nil && level != nil {
+		return clear
+	}
+	return level
+}
+
+func (r *ThresholdRule) clearRange(clear []float64, levelRange []float64) []float64 {
+	if clear != nil && levelRange != nil {
+		return clear
+	}
+	return levelRange
+}
+
+// thresholds holds the threshold rule of each metric, by metric name
+type thresholds map[string]*ThresholdRule
+
+// defaultThresholds applies the -threshold_warning and -threshold_critical levels to
+// the CPU, memory and filesystem usage percentages, and the -time_to_full_* levels to the disk full forecast
+func defaultThresholds() thresholds {
+	warning, critical := float64(*thresholdWarning), float64(*thresholdCritical)
+	rules := make(thresholds)
+	for _, name := range []string{"Cpu.Usage.TotalPercent", "Memory.UsagePercent", "Filesystem.UsagePercent"} {
+		rules[name] = &ThresholdRule{Warning: &warning, Critical: &critical}
+	}
+
+	fullWarning, fullCritical := timeToFullWarning.Seconds(), timeToFullCritical.Seconds()
+	rules["Filesystem.TimeToFull"] = &ThresholdRule{Warning: &fullWarning, Critical: &fullCritical, Inverted: true}
+	return rules
+}
+
+// thresholdRules are the threshold rules of every metric, along with the overrides of some containers
+type thresholdRules struct {
+	defaults  thresholds
+	overrides []*ThresholdOverride
+}
+
+// rule returns the threshold rule of a metric of subj: the one of the first override
+// matching subj that has one, or else the default one
+func (t *thresholdRules) rule(name string, subj subject) *ThresholdRule {
+	for _, override := range t.overrides {
+		if rule, found := override.Thresholds[name]; found && override.matches(subj) {
+			return rule
+		}
+	}
+	return t.defaults[name]
+}
+
+func metricValue(metric interface{}) (float64, bool) {
+	switch v := metric.(type) {
+	case int:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+)
+
+func level(v float64) *float64 {
+	return &v
+}
+
+func TestThresholdRuleState(t *testing.T) {
+	rule := &ThresholdRule{
+		Warning: level(80), WarningClear: level(70),
+		Critical: level(95), CriticalClear: level(90),
+	}
+	inverted := &ThresholdRule{Warning: level(20), Critical: level(5), Inverted: true}
+	ranges := &ThresholdRule{
+		WarningRange: []float64{10, 90}, WarningClearRange: []float64{20, 80},
+		CriticalRange: []float64{5, 95},
+	}
+
+	tests := []struct {
+		rule    *ThresholdRule
+		value   float64
+		current string
+		want    string
+	}{
+		{rule, 50, "ok", "ok"},
+		{rule, 85, "ok", "warning"},
+		{rule, 96, "ok", "critical"},
+		// Raised states hold until the value gets back within their clear level
+		{rule, 75, "warning", "warning"},
+		{rule, 75, "ok", "ok"},
+		{rule, 69, "warning", "ok"},
+		{rule, 92, "critical", "critical"},
+		{rule, 85, "critical", "warning"},
+		{rule, 75, "critical", "warning"},
+		{inverted, 50, "ok", "ok"},
+		{inverted, 10, "ok", "warning"},
+		{inverted, 1, "ok", "critical"},
+		{ranges, 50, "ok", "ok"},
+		{ranges, 92, "ok", "warning"},
+		{ranges, 85, "warning", "warning"},
+		{ranges, 75, "warning", "ok"},
+		{ranges, 2, "ok", "critical"},
+	}
+	for i, test := range tests {
+		if got := test.rule.state(test.value, test.current); got != test.want {
+			t.Errorf("#%d: state(%v, %s) = %s, want %s", i, test.value, test.current, got, test.want)
+		}
+	}
+}
+
+func TestThresholdRuleValidate(t *testing.T) {
+	tests := []struct {
+		rule  ThresholdRule
+		valid bool
+	}{
+		{ThresholdRule{Warning: level(80), WarningClear: level(70), Critical: level(95), CriticalClear: level(90)}, true},
+		{ThresholdRule{Warning: level(20), WarningClear: level(30), Critical: level(5), Inverted: true}, true},
+		{ThresholdRule{WarningRange: []float64{10, 90}, WarningClearRange: []float64{20, 80}, CriticalRange: []float64{5, 95}}, true},
+		{ThresholdRule{Warning: level(80), WarningRange: []float64{10, 90}}, false},
+		{ThresholdRule{WarningRange: []float64{10, 90}, Inverted: true}, false},
+		{ThresholdRule{WarningRange: []float64{90, 10}}, false},
+		{ThresholdRule{Warning: level(80), ForCycles: -1}, false},
+		// Clear levels on the bad side of their level, and misordered levels
+		{ThresholdRule{Warning: level(80), WarningClear: level(90)}, false},
+		{ThresholdRule{Warning: level(20), WarningClear: level(10), Inverted: true}, false},
+		{ThresholdRule{Critical: level(95), CriticalClear: level(99)}, false},
+		{ThresholdRule{Warning: level(90), Critical: level(80)}, false},
+		{ThresholdRule{Warning: level(5), Critical: level(20), Inverted: true}, false},
+		{ThresholdRule{WarningClear: level(70)}, false},
+		{ThresholdRule{WarningRange: []float64{10, 90}, CriticalRange: []float64{20, 95}}, false},
+		{ThresholdRule{WarningRange: []float64{10, 90}, WarningClearRange: []float64{5, 80}}, false},
+	}
+	for i, test := range tests {
+		err := test.rule.validate()
+		if (err == nil) != test.valid {
+			t.Errorf("#%d: validate() = %v, want valid %v", i, err, test.valid)
+		}
+	}
+}